@@ -0,0 +1,134 @@
+// Package classifier berisi model naive Bayes kecil untuk menyarankan kategori transaksi
+// dari deskripsi dan nominalnya. Model dilatih dan dijalankan sepenuhnya di memori.
+package classifier
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Prediction adalah satu label beserta peluangnya. Confidence seluruh label yang
+// dikembalikan Predict berjumlah paling banyak 1.
+type Prediction struct {
+	Label      string  `json:"label"`
+	Confidence float64 `json:"confidence"`
+}
+
+type classStats struct {
+	documents int
+	tokens    int
+	counts    map[string]int
+}
+
+// NaiveBayes adalah model multinomial naive Bayes dengan Laplace smoothing. Fitur
+// berupa token deskripsi ditambah satu token untuk rentang nominal. Model tidak aman
+// dipakai bersamaan dengan Train; setelah pelatihan selesai Predict aman dipanggil
+// dari banyak goroutine.
+type NaiveBayes struct {
+	classes   map[string]*classStats
+	vocab     map[string]bool
+	documents int
+}
+
+func NewNaiveBayes() *NaiveBayes {
+	return &NaiveBayes{classes: make(map[string]*classStats), vocab: make(map[string]bool)}
+}
+
+// Train menambahkan satu contoh berlabel ke model
+func (m *NaiveBayes) Train(label, description string, amount float64) {
+	stats := m.classes[label]
+	if stats == nil {
+		stats = &classStats{counts: make(map[string]int)}
+		m.classes[label] = stats
+	}
+	for _, token := range Features(description, amount) {
+		stats.counts[token]++
+		stats.tokens++
+		m.vocab[token] = true
+	}
+	stats.documents++
+	m.documents++
+}
+
+// Documents mengembalikan jumlah contoh yang sudah dilatih
+func (m *NaiveBayes) Documents() int {
+	return m.documents
+}
+
+// Predict mengembalikan label dengan peluang tertinggi, diurutkan menurun. allowed
+// membatasi label yang dipertimbangkan; nil berarti semua label.
+func (m *NaiveBayes) Predict(description string, amount float64, allowed func(label string) bool) []Prediction {
+	features := Features(description, amount)
+	vocabSize := float64(len(m.vocab))
+
+	var labels []string
+	var scores []float64
+	for label, stats := range m.classes {
+		if allowed != nil && !allowed(label) {
+			continue
+		}
+		score := math.Log(float64(stats.documents) / float64(m.documents))
+		for _, token := range features {
+			score += math.Log((float64(stats.counts[token]) + 1) / (float64(stats.tokens) + vocabSize))
+		}
+		labels = append(labels, label)
+		scores = append(scores, score)
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+
+	// Ubah log-likelihood menjadi peluang (softmax) agar bisa dipakai sebagai skor keyakinan
+	best := scores[0]
+	for _, score := range scores {
+		best = math.Max(best, score)
+	}
+	var sum float64
+	for i := range scores {
+		scores[i] = math.Exp(scores[i] - best)
+		sum += scores[i]
+	}
+
+	predictions := make([]Prediction, len(labels))
+	for i, label := range labels {
+		predictions[i] = Prediction{Label: label, Confidence: scores[i] / sum}
+	}
+	sort.Slice(predictions, func(i, j int) bool {
+		if predictions[i].Confidence != predictions[j].Confidence {
+			return predictions[i].Confidence > predictions[j].Confidence
+		}
+		return predictions[i].Label < predictions[j].Label
+	})
+	return predictions
+}
+
+// Features memecah deskripsi menjadi token huruf kecil (angka murni seperti tanggal atau
+// nomor referensi diabaikan) dan menambahkan token rentang nominal.
+func Features(description string, amount float64) []string {
+	fields := strings.FieldsFunc(strings.ToLower(description), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var tokens []string
+	for _, field := range fields {
+		if len([]rune(field)) < 2 || strings.IndexFunc(field, unicode.IsLetter) < 0 {
+			continue
+		}
+		tokens = append(tokens, field)
+	}
+	if bucket := amountBucket(amount); bucket != "" {
+		tokens = append(tokens, bucket)
+	}
+	return tokens
+}
+
+// Rentang nominal berskala logaritmik, dua rentang per kelipatan sepuluh
+func amountBucket(amount float64) string {
+	if amount <= 0 {
+		return ""
+	}
+	return "#amount:" + strconv.Itoa(int(math.Floor(math.Log10(amount)*2)))
+}
@@ -0,0 +1,110 @@
+package classifier
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestFeatures(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		amount      float64
+		want        []string
+	}{
+		{"lowercases and splits on punctuation", "GRAB*Food Jakarta", 0, []string{"grab", "food", "jakarta"}},
+		{"drops pure numbers and single characters", "Transfer 12/05 ref 88213 a", 0, []string{"transfer", "ref"}},
+		{"keeps mixed tokens", "Pulsa XL 50k", 0, []string{"pulsa", "xl", "50k"}},
+		{"adds amount bucket", "Kopi", 25000, []string{"kopi", "#amount:8"}},
+		{"ignores non-positive amount", "Kopi", -5, []string{"kopi"}},
+		{"empty description keeps bucket", "", 1, []string{"#amount:0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Features(tt.description, tt.amount); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Features(%q, %v) = %v, want %v", tt.description, tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmountBucketSeparatesMagnitudes(t *testing.T) {
+	if amountBucket(20000) != amountBucket(25000) {
+		t.Errorf("close amounts should share a bucket: %s vs %s", amountBucket(20000), amountBucket(25000))
+	}
+	if amountBucket(25000) == amountBucket(2500000) {
+		t.Errorf("amounts 100x apart should not share a bucket")
+	}
+}
+
+func trainedModel() *NaiveBayes {
+	model := NewNaiveBayes()
+	model.Train("food", "GrabFood nasi goreng", 35000)
+	model.Train("food", "GoFood ayam geprek", 28000)
+	model.Train("food", "Warung nasi padang", 30000)
+	model.Train("transport", "GrabCar kantor", 60000)
+	model.Train("transport", "Gojek ride kantor", 25000)
+	model.Train("salary", "Gaji bulanan PT Maju", 10000000)
+	return model
+}
+
+func TestPredictRanksMostLikelyLabel(t *testing.T) {
+	model := trainedModel()
+	if model.Documents() != 6 {
+		t.Fatalf("Documents() = %d, want 6", model.Documents())
+	}
+
+	tests := []struct {
+		description string
+		amount      float64
+		want        string
+	}{
+		{"nasi goreng", 32000, "food"},
+		{"ride ke kantor", 40000, "transport"},
+		{"Gaji Maret", 10000000, "salary"},
+	}
+	for _, tt := range tests {
+		predictions := model.Predict(tt.description, tt.amount, nil)
+		if len(predictions) != 3 {
+			t.Fatalf("Predict(%q) returned %d labels, want 3", tt.description, len(predictions))
+		}
+		if predictions[0].Label != tt.want {
+			t.Errorf("Predict(%q) top label = %s, want %s (%+v)", tt.description, predictions[0].Label, tt.want, predictions)
+		}
+
+		var sum float64
+		for i, prediction := range predictions {
+			sum += prediction.Confidence
+			if i > 0 && prediction.Confidence > predictions[i-1].Confidence {
+				t.Errorf("predictions are not sorted by confidence: %+v", predictions)
+			}
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("confidences sum to %v, want 1", sum)
+		}
+	}
+}
+
+func TestPredictRespectsAllowedLabels(t *testing.T) {
+	model := trainedModel()
+	predictions := model.Predict("nasi goreng", 32000, func(label string) bool { return label != "food" })
+	for _, prediction := range predictions {
+		if prediction.Label == "food" {
+			t.Fatalf("disallowed label returned: %+v", predictions)
+		}
+	}
+	if len(predictions) != 2 {
+		t.Fatalf("got %d predictions, want 2", len(predictions))
+	}
+
+	if got := model.Predict("nasi goreng", 0, func(string) bool { return false }); got != nil {
+		t.Errorf("expected nil when no label is allowed, got %+v", got)
+	}
+}
+
+func TestPredictOnEmptyModel(t *testing.T) {
+	if got := NewNaiveBayes().Predict("kopi", 20000, nil); got != nil {
+		t.Errorf("empty model should predict nothing, got %+v", got)
+	}
+}
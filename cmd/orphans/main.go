@@ -0,0 +1,75 @@
+// Command orphans melaporkan transaksi (termasuk baris split) yang kategorinya tidak valid:
+// kategori sudah dihapus, milik user lain, atau bertipe berbeda dengan transaksi.
+//
+//	go run ./cmd/orphans
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"finance-app/database"
+	"finance-app/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type orphanRow struct {
+	models.Transaction `bson:",inline"`
+	Category           []models.Category `bson:"category"`
+}
+
+func main() {
+	client, err := database.ConnectDB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+
+	// Transaksi di tempat sampah dilewati, transaksi split diperiksa per baris split
+	pipeline := []bson.M{{"$match": bson.M{"deleted_at": nil}}}
+	pipeline = append(pipeline, database.SplitLineStages()...)
+	pipeline = append(pipeline, bson.M{"$lookup": bson.M{
+		"from":         "categories",
+		"localField":   "category_id",
+		"foreignField": "_id",
+		"as":           "category",
+	}})
+
+	cursor, err := database.TransactionCollection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cursor.Close(context.Background())
+
+	var total, orphans int
+	for cursor.Next(context.Background()) {
+		var row orphanRow
+		if err := cursor.Decode(&row); err != nil {
+			log.Fatal(err)
+		}
+		total++
+
+		var reason string
+		switch {
+		case len(row.Category) == 0:
+			reason = "category not found"
+		case row.Category[0].DeletedAt != nil:
+			reason = "category is in trash"
+		case row.Category[0].UserID != row.UserID:
+			reason = "category owned by another user"
+		case row.Category[0].Type != row.Type:
+			reason = fmt.Sprintf("category type %q does not match transaction type %q", row.Category[0].Type, row.Type)
+		default:
+			continue
+		}
+
+		orphans++
+		fmt.Printf("%s\tuser=%s\tcategory=%s\t%s\n", row.ID.Hex(), row.UserID.Hex(), row.CategoryID.Hex(), reason)
+	}
+	if err := cursor.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("%d of %d transaction lines have an invalid category\n", orphans, total)
+}
@@ -0,0 +1,58 @@
+// Command rebuild-balances menghitung ulang snapshot saldo (total dan per bulan) dari
+// transaksi. Jalankan setelah deploy pertama atau jika snapshot dicurigai tidak sesuai.
+//
+//	go run ./cmd/rebuild-balances
+//	go run ./cmd/rebuild-balances -user <user_id>
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"finance-app/controllers"
+	"finance-app/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func main() {
+	userHex := flag.String("user", "", "rebuild only this user ID")
+	flag.Parse()
+
+	client, err := database.ConnectDB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+
+	var userIDs []primitive.ObjectID
+	if *userHex != "" {
+		userID, err := primitive.ObjectIDFromHex(*userHex)
+		if err != nil {
+			log.Fatalf("Invalid user ID: %v", err)
+		}
+		userIDs = append(userIDs, userID)
+	} else {
+		ids, err := database.UserCollection.Distinct(context.Background(), "_id", bson.M{})
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, id := range ids {
+			if userID, ok := id.(primitive.ObjectID); ok {
+				userIDs = append(userIDs, userID)
+			}
+		}
+	}
+
+	failed := 0
+	for _, userID := range userIDs {
+		if err := controllers.RebuildBalanceSnapshots(userID); err != nil {
+			log.Printf("user %s: %v", userID.Hex(), err)
+			failed++
+		}
+	}
+
+	fmt.Printf("%d user diproses, %d gagal\n", len(userIDs), failed)
+}
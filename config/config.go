@@ -0,0 +1,23 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+// GetEnv membaca environment variable, atau mengembalikan fallback jika kosong
+func GetEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// GetEnvInt64 membaca environment variable berupa angka, atau mengembalikan fallback jika kosong/tidak valid
+func GetEnvInt64(key string, fallback int64) int64 {
+	value, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,296 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"finance-app/config"
+	"finance-app/database"
+	"finance-app/models"
+	"finance-app/storage"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errAttachmentQuotaExceeded = errors.New("Storage quota exceeded")
+
+// Tipe file struk yang diizinkan
+var allowedAttachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+func UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dan user yang mengunggah dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	params := mux.Vars(r)
+	transactionID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	// Pastikan transaksi milik user
+	count, err := database.TransactionCollection.CountDocuments(context.Background(), bson.M{"_id": transactionID, "user_id": ledgerID, "deleted_at": nil})
+	if err != nil {
+		http.Error(w, "Error finding transaction", http.StatusInternalServerError)
+		return
+	}
+	if count == 0 {
+		http.Error(w, "Transaction not found or not owned by user", http.StatusNotFound)
+		return
+	}
+
+	maxSize := config.GetEnvInt64("ATTACHMENT_MAX_BYTES", 5<<20)
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+(1<<20)) // Sisakan ruang untuk header multipart
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Missing or too large 'file' field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxSize {
+		http.Error(w, "Attachment exceeds maximum size", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Deteksi tipe file dari isinya, bukan dari header yang dikirim client
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		http.Error(w, "Error reading attachment", http.StatusBadRequest)
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(sniff[:n]))
+	if !allowedAttachmentTypes[contentType] {
+		http.Error(w, "Unsupported attachment type. Must be JPEG, PNG, WebP or PDF", http.StatusUnsupportedMediaType)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Error reading attachment", http.StatusInternalServerError)
+		return
+	}
+
+	// Pesan kuota penyimpanan user sebelum file disimpan
+	if err := reserveAttachmentQuota(actorID, header.Size); err == errAttachmentQuotaExceeded {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, "Error checking storage quota", http.StatusInternalServerError)
+		return
+	}
+
+	attachment := models.Attachment{
+		ID:            primitive.NewObjectID(),
+		TransactionID: transactionID,
+		UserID:        ledgerID,
+		UploadedBy:    actorID,
+		FileName:      filepath.Base(header.Filename),
+		ContentType:   contentType,
+		Size:          header.Size,
+		CreatedAt:     time.Now(),
+	}
+
+	if err := storage.Attachments.Save(r.Context(), attachment.ID.Hex(), attachment.FileName, file); err != nil {
+		releaseAttachmentQuota(actorID, attachment.Size)
+		http.Error(w, "Error storing attachment", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = database.AttachmentCollection.InsertOne(context.Background(), attachment)
+	if err != nil {
+		storage.Attachments.Delete(context.Background(), attachment.ID.Hex())
+		releaseAttachmentQuota(actorID, attachment.Size)
+		http.Error(w, "Error saving attachment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+func GetAttachments(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	params := mux.Vars(r)
+	transactionID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	cursor, err := database.AttachmentCollection.Find(context.Background(), bson.M{"transaction_id": transactionID, "user_id": ledgerID})
+	if err != nil {
+		http.Error(w, "Error fetching attachments", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	attachments := []models.Attachment{}
+	if err = cursor.All(context.Background(), &attachments); err != nil {
+		http.Error(w, "Error decoding attachments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachments)
+}
+
+func DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	params := mux.Vars(r)
+	attachmentID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+
+	var attachment models.Attachment
+	err = database.AttachmentCollection.FindOne(context.Background(), bson.M{"_id": attachmentID, "user_id": ledgerID}).Decode(&attachment)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Error finding attachment", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	content, err := storage.Attachments.Open(r.Context(), attachment.ID.Hex())
+	if err != nil {
+		if err == storage.ErrNotFound {
+			http.Error(w, "Attachment file not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Error opening attachment", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}))
+	io.Copy(w, content)
+}
+
+func DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	params := mux.Vars(r)
+	attachmentID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+
+	var attachment models.Attachment
+	err = database.AttachmentCollection.FindOneAndDelete(context.Background(), bson.M{"_id": attachmentID, "user_id": ledgerID}).Decode(&attachment)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Error deleting attachment", http.StatusInternalServerError)
+		}
+		return
+	}
+	if err := releaseAttachmentQuota(attachment.UploadedBy, attachment.Size); err != nil {
+		log.Printf("Error releasing attachment quota for user %s: %v", attachment.UploadedBy.Hex(), err)
+	}
+
+	if err := storage.Attachments.Delete(r.Context(), attachmentID.Hex()); err != nil && err != storage.ErrNotFound {
+		log.Printf("Error deleting attachment file %s: %v", attachmentID.Hex(), err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Attachment deleted successfully"})
+}
+
+// Fungsi helper untuk memesan kuota lampiran user. Pemeriksaan dan penambahan dilakukan
+// dalam satu update agar unggahan bersamaan tidak bisa melewati kuota.
+func reserveAttachmentQuota(userID primitive.ObjectID, size int64) error {
+	quota := config.GetEnvInt64("ATTACHMENT_QUOTA_BYTES", 100<<20)
+	if size > quota {
+		return errAttachmentQuotaExceeded
+	}
+
+	// Pastikan dokumen pemakaian sudah ada, karena filter kuota tidak bisa dipakai untuk upsert
+	_, err := database.AttachmentUsageCollection.UpdateOne(context.Background(),
+		bson.M{"_id": userID},
+		bson.M{"$setOnInsert": bson.M{"bytes": int64(0)}},
+		options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	result, err := database.AttachmentUsageCollection.UpdateOne(context.Background(),
+		bson.M{"_id": userID, "bytes": bson.M{"$lte": quota - size}},
+		bson.M{"$inc": bson.M{"bytes": size}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errAttachmentQuotaExceeded
+	}
+	return nil
+}
+
+// Fungsi helper untuk mengembalikan kuota lampiran yang dihapus atau gagal disimpan
+func releaseAttachmentQuota(userID primitive.ObjectID, size int64) error {
+	_, err := database.AttachmentUsageCollection.UpdateOne(context.Background(),
+		bson.M{"_id": userID},
+		bson.M{"$inc": bson.M{"bytes": -size}})
+	return err
+}
+
+// Fungsi helper untuk menghapus semua lampiran dari transaksi yang dihapus
+func deleteTransactionAttachments(userID primitive.ObjectID, transactionIDs []primitive.ObjectID) error {
+	if len(transactionIDs) == 0 {
+		return nil
+	}
+	filter := bson.M{"user_id": userID, "transaction_id": bson.M{"$in": transactionIDs}}
+
+	cursor, err := database.AttachmentCollection.Find(context.Background(), filter)
+	if err != nil {
+		return err
+	}
+	var attachments []models.Attachment
+	if err = cursor.All(context.Background(), &attachments); err != nil {
+		return err
+	}
+
+	for _, attachment := range attachments {
+		if err := storage.Attachments.Delete(context.Background(), attachment.ID.Hex()); err != nil && err != storage.ErrNotFound {
+			return err
+		}
+		// Kuota hanya dikembalikan oleh request yang benar-benar menghapus metadatanya
+		result, err := database.AttachmentCollection.DeleteOne(context.Background(), bson.M{"_id": attachment.ID})
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount > 0 {
+			if err := releaseAttachmentQuota(attachment.UploadedBy, attachment.Size); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"finance-app/database"
+	"finance-app/models"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Fungsi helper untuk mencatat perubahan dokumen ke audit log. before bernilai nil
+// untuk operasi create dan after bernilai nil untuk operasi delete. Kegagalan
+// pencatatan hanya di-log agar tidak membatalkan operasi utama.
+func recordAudit(actorID, ownerID primitive.ObjectID, collection, operation string, documentID primitive.ObjectID, before, after interface{}) {
+	entry := models.AuditLog{
+		UserID:     ownerID,
+		ActorID:    actorID,
+		Collection: collection,
+		DocumentID: documentID,
+		Operation:  operation,
+		Timestamp:  time.Now(),
+		Before:     toBsonM(before),
+		After:      toBsonM(after),
+	}
+	entry.Changes = diffDocuments(entry.Before, entry.After)
+
+	if _, err := database.AuditLogCollection.InsertOne(context.Background(), entry); err != nil {
+		log.Printf("Error recording audit log for %s %s: %v", collection, documentID.Hex(), err)
+	}
+}
+
+func toBsonM(doc interface{}) bson.M {
+	if v := reflect.ValueOf(doc); !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return nil
+	}
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil
+	}
+	var m bson.M
+	if err := bson.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// Fungsi helper untuk membandingkan field level atas dari dua dokumen
+func diffDocuments(before, after bson.M) map[string]models.FieldChange {
+	changes := make(map[string]models.FieldChange)
+	for key, value := range before {
+		if !reflect.DeepEqual(value, after[key]) {
+			changes[key] = models.FieldChange{Before: value, After: after[key]}
+		}
+	}
+	for key, value := range after {
+		if _, ok := before[key]; !ok {
+			changes[key] = models.FieldChange{Before: nil, After: value}
+		}
+	}
+	delete(changes, "_id")
+	return changes
+}
+
+// GetDocumentHistory mengembalikan riwayat perubahan satu transaksi atau kategori
+func GetDocumentHistory(collection string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Ambil ledger aktif dari context
+		ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+		params := mux.Vars(r)
+		documentID, err := primitive.ObjectIDFromHex(params["id"])
+		if err != nil {
+			http.Error(w, "Invalid document ID", http.StatusBadRequest)
+			return
+		}
+
+		filter := bson.M{"user_id": ledgerID, "collection": collection, "document_id": documentID}
+		writeAuditLogs(w, filter, 0)
+	}
+}
+
+// GetAuditLogs mengembalikan riwayat perubahan milik user, dengan filter opsional
+// collection, operation, start_date/end_date, dan limit.
+func GetAuditLogs(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	filter := bson.M{"user_id": ledgerID}
+	if collection := r.URL.Query().Get("collection"); collection != "" {
+		filter["collection"] = collection
+	}
+	if operation := r.URL.Query().Get("operation"); operation != "" {
+		filter["operation"] = operation
+	}
+	if r.URL.Query().Get("start_date") != "" || r.URL.Query().Get("end_date") != "" {
+		startDate, endDate, err := parseDateRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter["timestamp"] = bson.M{"$gte": startDate, "$lt": endDate}
+	}
+
+	limit := int64(100)
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.ParseInt(limitStr, 10, 64)
+		if err != nil || parsed <= 0 || parsed > 1000 {
+			http.Error(w, "Invalid limit. Must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	writeAuditLogs(w, filter, limit)
+}
+
+func writeAuditLogs(w http.ResponseWriter, filter bson.M, limit int64) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}})
+	if limit > 0 {
+		findOptions.SetLimit(limit)
+	}
+
+	cursor, err := database.AuditLogCollection.Find(context.Background(), filter, findOptions)
+	if err != nil {
+		http.Error(w, "Error fetching history", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	var logs []models.AuditLog
+	if err = cursor.All(context.Background(), &logs); err != nil {
+		http.Error(w, "Error decoding history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logs)
+}
@@ -0,0 +1,519 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"finance-app/database"
+	"finance-app/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Periode dokumen snapshot saldo user (total keseluruhan beserta total per bulan)
+	allTimePeriod = "all"
+	// Penanda penulisan transaksi yang lebih tua dari ini dianggap milik request yang gagal
+	// di tengah jalan (misalnya server mati) dan tidak lagi menahan rebuild
+	balanceWriterLease = time.Minute
+	// Berapa kali rebuild dicoba jika bertabrakan dengan penulisan transaksi
+	balanceRebuildAttempts = 5
+)
+
+var errBalanceRebuildBusy = errors.New("Balance snapshot is being written concurrently; try again later")
+
+// Fungsi untuk mendapatkan saldo saat ini, atau saldo pada akhir tanggal ?as_of=YYYY-MM-DD
+func GetCurrentBalance(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	if asOfStr := r.URL.Query().Get("as_of"); asOfStr != "" {
+		// Akhir tanggal dihitung di zona waktu user, sama seperti laporan lainnya
+		location, err := userLocation(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		asOf, err := time.ParseInLocation("2006-01-02", asOfStr, location)
+		if err != nil {
+			http.Error(w, "Invalid as_of date. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		endOfDay := asOf.AddDate(0, 0, 1)
+
+		balance, err := balanceThrough(ledgerID, endOfDay, bson.M{"date": bson.M{"$lt": endOfDay}})
+		if err != nil {
+			http.Error(w, "Error calculating balance", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"balance": balance, "as_of": asOfStr})
+		return
+	}
+
+	balance, err := calculateCurrentBalance(ledgerID)
+	if err != nil {
+		http.Error(w, "Error calculating current balance", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"balance": balance})
+}
+
+// GetMonthlyBalances mengembalikan snapshot total per bulan untuk rentang ?from=YYYY-MM&to=YYYY-MM
+func GetMonthlyBalances(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	bounds := map[string]string{}
+	for _, param := range []string{"from", "to"} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01", value); err != nil {
+			http.Error(w, "Invalid month. Use YYYY-MM", http.StatusBadRequest)
+			return
+		}
+		bounds[param] = value
+	}
+
+	state, err := loadBalanceState(ledgerID)
+	if err != nil {
+		http.Error(w, "Error loading balance snapshots", http.StatusInternalServerError)
+		return
+	}
+
+	snapshots := []models.BalanceSnapshot{}
+	for period, totals := range state.Months {
+		if totals.Count == 0 {
+			continue // Semua transaksi bulan ini sudah dihapus
+		}
+		if (bounds["from"] != "" && period < bounds["from"]) || (bounds["to"] != "" && period > bounds["to"]) {
+			continue
+		}
+		snapshots = append(snapshots, models.BalanceSnapshot{
+			Period:       period,
+			TotalIncome:  totals.TotalIncome,
+			TotalExpense: totals.TotalExpense,
+			Count:        totals.Count,
+			UpdatedAt:    state.UpdatedAt,
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Period < snapshots[j].Period })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+func calculateCurrentBalance(userID primitive.ObjectID) (float64, error) {
+	snapshot, err := getBalanceSnapshot(userID)
+	if err != nil {
+		return 0, err
+	}
+	return snapshot.TotalIncome - snapshot.TotalExpense, nil
+}
+
+// Fungsi helper untuk menghitung saldo (pemasukan dikurangi pengeluaran) dari transaksi
+// yang cocok dengan filter
+func sumBalance(filter bson.M) (float64, error) {
+	pipeline := []bson.M{
+		{"$match": filter},
+		{"$group": bson.M{
+			"_id": nil,
+			"balance": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$type", "income"}},
+				"$amount",
+				bson.M{"$multiply": bson.A{"$amount", -1}},
+			}}},
+		}},
+	}
+
+	cursor, err := database.TransactionCollection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(context.Background())
+
+	var result []struct {
+		Balance float64 `bson:"balance"`
+	}
+	if err = cursor.All(context.Background(), &result); err != nil {
+		return 0, err
+	}
+
+	if len(result) == 0 {
+		return 0, nil // Tidak ada transaksi, saldo 0
+	}
+	return result[0].Balance, nil
+}
+
+// Fungsi helper untuk menghitung saldo sampai suatu titik di bulan milik date. Bulan-bulan
+// sebelumnya dibaca dari snapshot bulanan, sehingga hanya transaksi bulan itu yang
+// dijumlahkan ulang; within membatasi transaksi bulan itu yang ikut dihitung.
+func balanceThrough(userID primitive.ObjectID, date time.Time, within bson.M) (float64, error) {
+	state, err := loadBalanceState(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	utc := date.UTC()
+	monthStart := time.Date(utc.Year(), utc.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var balance float64
+	for period, totals := range state.Months {
+		if period < balancePeriod(monthStart) {
+			balance += totals.TotalIncome - totals.TotalExpense
+		}
+	}
+
+	monthBalance, err := sumBalance(bson.M{
+		"user_id":    userID,
+		"deleted_at": nil,
+		"$and":       []bson.M{{"date": bson.M{"$gte": monthStart}}, within},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return balance + monthBalance, nil
+}
+
+// Fungsi helper untuk mengisi RunningBalance pada satu halaman transaksi yang diurutkan
+// dari yang terbaru (date lalu _id menurun). Saldo transaksi tertua di halaman dihitung
+// dari seluruh transaksi sebelumnya, lalu transaksi aktif di antara baris tertua dan
+// terbaru dijumlahkan berurutan, termasuk yang tidak lolos filter daftar, sehingga
+// saldo setiap baris tetap sama dengan saldo rekening setelah transaksi itu.
+func fillRunningBalances(userID primitive.ObjectID, transactions []models.Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	oldest, newest := transactions[len(transactions)-1], transactions[0]
+
+	balance, err := balanceThrough(userID, oldest.Date, throughTransaction(oldest))
+	if err != nil {
+		return err
+	}
+
+	rows := make(map[primitive.ObjectID]int, len(transactions))
+	for i, tx := range transactions {
+		rows[tx.ID] = i
+	}
+	setRunningBalance(&transactions[len(transactions)-1], balance)
+
+	filter := bson.M{
+		"user_id":    userID,
+		"deleted_at": nil,
+		"$and": []bson.M{
+			{"$or": []bson.M{
+				{"date": bson.M{"$gt": oldest.Date}},
+				{"date": oldest.Date, "_id": bson.M{"$gt": oldest.ID}},
+			}},
+			throughTransaction(newest),
+		},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "date", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(bson.M{"type": 1, "amount": 1, "date": 1})
+	cursor, err := database.TransactionCollection.Find(context.Background(), filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		var tx models.Transaction
+		if err := cursor.Decode(&tx); err != nil {
+			return err
+		}
+		if tx.Type == "income" {
+			balance += tx.Amount
+		} else {
+			balance -= tx.Amount
+		}
+		if i, ok := rows[tx.ID]; ok {
+			setRunningBalance(&transactions[i], balance)
+		}
+	}
+	return cursor.Err()
+}
+
+// Filter transaksi yang berada pada atau sebelum tx dalam urutan (date, _id)
+func throughTransaction(tx models.Transaction) bson.M {
+	return bson.M{"$or": []bson.M{
+		{"date": bson.M{"$lt": tx.Date}},
+		{"date": tx.Date, "_id": bson.M{"$lte": tx.ID}},
+	}}
+}
+
+func setRunningBalance(tx *models.Transaction, balance float64) {
+	tx.RunningBalance = &balance
+}
+
+// Fungsi helper untuk membaca snapshot total user
+func getBalanceSnapshot(userID primitive.ObjectID) (models.BalanceSnapshot, error) {
+	state, err := loadBalanceState(userID)
+	return models.BalanceSnapshot{
+		Period:       allTimePeriod,
+		TotalIncome:  state.TotalIncome,
+		TotalExpense: state.TotalExpense,
+		Count:        state.Count,
+		UpdatedAt:    state.UpdatedAt,
+	}, err
+}
+
+// Fungsi helper untuk membaca snapshot saldo user. Snapshot dibangun ulang jika belum
+// pernah dibangun (misalnya user lama sebelum snapshot diperkenalkan) atau ditandai stale.
+// Jika rebuild terus bertabrakan dengan penulisan lain, hasil hitungan langsung dari
+// transaksi tetap dikembalikan tanpa disimpan.
+func loadBalanceState(userID primitive.ObjectID) (models.BalanceState, error) {
+	state, err := findBalanceState(userID)
+	if err != nil || (state.Generation > 0 && !state.Stale) {
+		return state, err
+	}
+	state, err = rebuildBalanceState(userID)
+	if err == errBalanceRebuildBusy {
+		return state, nil
+	}
+	return state, err
+}
+
+// Fungsi helper untuk membaca dokumen snapshot apa adanya. Dokumen yang belum ada
+// dikembalikan sebagai snapshot kosong dengan Generation 0.
+func findBalanceState(userID primitive.ObjectID) (models.BalanceState, error) {
+	var state models.BalanceState
+	err := database.BalanceCollection.FindOne(context.Background(), bson.M{"user_id": userID, "period": allTimePeriod}).Decode(&state)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.BalanceState{UserID: userID, Period: allTimePeriod}, nil
+	}
+	return state, err
+}
+
+// beginBalanceWrite dipanggil sebelum menulis transaksi milik userID, dan fungsi yang
+// dikembalikan dipanggil (biasanya dengan defer) setelah recordTransactionChange. Selama
+// penanda ini ada, rebuild tidak menyimpan hasilnya, sehingga transaksi yang sudah
+// tersimpan tetapi deltanya belum diterapkan tidak terhitung dua kali.
+func beginBalanceWrite(userID primitive.ObjectID) (func(), error) {
+	writer := models.BalanceWriter{ID: primitive.NewObjectID(), StartedAt: time.Now()}
+	filter := bson.M{"user_id": userID, "period": allTimePeriod}
+	update := bson.M{"$push": bson.M{"writers": writer}}
+	opts := options.Update().SetUpsert(true)
+
+	// Upsert bersamaan untuk user yang sama bisa bentrok di unique index; ulangi sekali
+	_, err := database.BalanceCollection.UpdateOne(context.Background(), filter, update, opts)
+	if mongo.IsDuplicateKeyError(err) {
+		_, err = database.BalanceCollection.UpdateOne(context.Background(), filter, update, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		_, err := database.BalanceCollection.UpdateOne(context.Background(), filter,
+			bson.M{"$pull": bson.M{"writers": bson.M{"_id": writer.ID}}})
+		if err != nil {
+			log.Printf("Error releasing balance writer for user %s: %v", userID.Hex(), err)
+		}
+	}, nil
+}
+
+// Fungsi helper untuk mencatat perubahan transaksi ke audit log sekaligus memperbarui
+// snapshot saldo dan membuang model saran kategori. before dan after yang berada di
+// tempat sampah tidak dihitung. Pemanggil harus sudah memanggil beginBalanceWrite untuk
+// ownerID sebelum menulis transaksi.
+func recordTransactionChange(actorID, ownerID primitive.ObjectID, operation string, documentID primitive.ObjectID, before, after *models.Transaction) {
+	recordAudit(actorID, ownerID, "transactions", operation, documentID, before, after)
+	invalidateSuggestionModel(ownerID)
+
+	if before != nil && before.DeletedAt == nil {
+		applyBalanceDelta(ownerID, before, -1)
+	}
+	if after != nil && after.DeletedAt == nil {
+		applyBalanceDelta(ownerID, after, 1)
+	}
+}
+
+// Fungsi helper untuk menambah (sign 1) atau mengurangi (sign -1) satu transaksi dari
+// total keseluruhan dan total bulannya dalam satu $inc. Jika gagal, snapshot ditandai
+// stale agar dibangun ulang saat dibaca berikutnya.
+func applyBalanceDelta(userID primitive.ObjectID, tx *models.Transaction, sign float64) {
+	_, err := database.BalanceCollection.UpdateOne(context.Background(),
+		bson.M{"user_id": userID, "period": allTimePeriod}, balanceDeltaUpdate(tx, sign))
+	if err == nil {
+		return
+	}
+	log.Printf("Error updating balance snapshot for user %s: %v", userID.Hex(), err)
+
+	_, err = database.BalanceCollection.UpdateOne(context.Background(),
+		bson.M{"user_id": userID, "period": allTimePeriod}, bson.M{"$set": bson.M{"stale": true}})
+	if err != nil {
+		log.Printf("Error marking balance snapshot stale for user %s: %v", userID.Hex(), err)
+	}
+}
+
+// Fungsi helper untuk menyusun update delta satu transaksi
+func balanceDeltaUpdate(tx *models.Transaction, sign float64) bson.M {
+	field := "total_expense"
+	if tx.Type == "income" {
+		field = "total_income"
+	}
+	month := "months." + balancePeriod(tx.Date) + "."
+	return bson.M{
+		"$inc": bson.M{
+			field:           sign * tx.Amount,
+			"count":         int64(sign),
+			month + field:   sign * tx.Amount,
+			month + "count": int64(sign),
+			"seq":           1,
+		},
+		"$set": bson.M{"updated_at": time.Now()},
+	}
+}
+
+// Fungsi helper untuk menambahkan satu transaksi ke snapshot di memori, padanan
+// balanceDeltaUpdate untuk rebuild
+func addToBalanceState(state *models.BalanceState, tx *models.Transaction, sign float64) {
+	if state.Months == nil {
+		state.Months = make(map[string]models.BalanceTotals)
+	}
+	period := balancePeriod(tx.Date)
+	month := state.Months[period]
+	if tx.Type == "income" {
+		state.TotalIncome += sign * tx.Amount
+		month.TotalIncome += sign * tx.Amount
+	} else {
+		state.TotalExpense += sign * tx.Amount
+		month.TotalExpense += sign * tx.Amount
+	}
+	state.Count += int64(sign)
+	month.Count += int64(sign)
+	state.Months[period] = month
+}
+
+// Fungsi helper untuk periode snapshot bulanan. Periode memakai bulan UTC agar tidak
+// bergantung pada zona waktu server; saldo pada tanggal tertentu tetap dihitung di zona
+// waktu user karena sisa bulannya dijumlahkan dari transaksi.
+func balancePeriod(date time.Time) string {
+	return date.UTC().Format("2006-01")
+}
+
+// RebuildBalanceSnapshots menghitung ulang snapshot saldo user dari transaksi yang aktif.
+// errBalanceRebuildBusy berarti penulisan transaksi terus berjalan selama rebuild.
+func RebuildBalanceSnapshots(userID primitive.ObjectID) error {
+	_, err := rebuildBalanceState(userID)
+	return err
+}
+
+// Fungsi helper untuk membangun ulang snapshot. Hasil hitungan hanya disimpan jika tidak
+// ada penulisan transaksi yang berjalan dan tidak ada delta (Seq berubah) sejak sebelum
+// transaksi dibaca; jika ada, perhitungan diulang. Hasil hitungan terakhir tetap
+// dikembalikan bersama errBalanceRebuildBusy.
+func rebuildBalanceState(userID primitive.ObjectID) (models.BalanceState, error) {
+	var state models.BalanceState
+	for attempt := 0; attempt < balanceRebuildAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 20 * time.Millisecond)
+		}
+
+		current, err := findBalanceState(userID)
+		if err != nil {
+			return state, err
+		}
+		cutoff := time.Now().Add(-balanceWriterLease)
+
+		state, err = computeBalanceState(userID)
+		if err != nil {
+			return state, err
+		}
+		if hasActiveBalanceWriters(current, cutoff) {
+			continue
+		}
+
+		committed, err := commitBalanceState(userID, current.Seq, cutoff, &state)
+		if err != nil {
+			return state, err
+		}
+		if committed {
+			// Bersihkan snapshot bulanan format lama (satu dokumen per bulan)
+			_, err = database.BalanceCollection.DeleteMany(context.Background(), bson.M{"user_id": userID, "period": bson.M{"$ne": allTimePeriod}})
+			return state, err
+		}
+	}
+	return state, errBalanceRebuildBusy
+}
+
+func hasActiveBalanceWriters(state models.BalanceState, cutoff time.Time) bool {
+	for _, writer := range state.Writers {
+		if writer.StartedAt.After(cutoff) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fungsi helper untuk menjumlahkan semua transaksi aktif user
+func computeBalanceState(userID primitive.ObjectID) (models.BalanceState, error) {
+	state := models.BalanceState{UserID: userID, Period: allTimePeriod, Months: make(map[string]models.BalanceTotals)}
+
+	opts := options.Find().SetProjection(bson.M{"type": 1, "amount": 1, "date": 1})
+	cursor, err := database.TransactionCollection.Find(context.Background(), bson.M{"user_id": userID, "deleted_at": nil}, opts)
+	if err != nil {
+		return state, err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		var tx models.Transaction
+		if err := cursor.Decode(&tx); err != nil {
+			return state, err
+		}
+		addToBalanceState(&state, &tx, 1)
+	}
+	state.UpdatedAt = time.Now()
+	return state, cursor.Err()
+}
+
+// Fungsi helper untuk menyimpan hasil rebuild dengan compare-and-swap pada Seq: dokumen
+// hanya diganti jika tidak ada delta baru dan tidak ada penulisan aktif. Penanda
+// penulisan yang sudah melewati masa berlaku dibuang.
+func commitBalanceState(userID primitive.ObjectID, seq int64, cutoff time.Time, state *models.BalanceState) (bool, error) {
+	filter := bson.M{
+		"user_id": userID,
+		"period":  allTimePeriod,
+		"seq":     versionFilter(seq),
+		"writers": bson.M{"$not": bson.M{"$elemMatch": bson.M{"started_at": bson.M{"$gt": cutoff}}}},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"total_income":  state.TotalIncome,
+			"total_expense": state.TotalExpense,
+			"count":         state.Count,
+			"months":        state.Months,
+			"stale":         false,
+			"updated_at":    state.UpdatedAt,
+		},
+		"$inc":  bson.M{"generation": 1},
+		"$pull": bson.M{"writers": bson.M{"started_at": bson.M{"$lte": cutoff}}},
+	}
+
+	var saved models.BalanceState
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := database.BalanceCollection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&saved)
+	if mongo.IsDuplicateKeyError(err) {
+		// Dokumen ada tetapi tidak cocok dengan filter: ada delta atau penulisan baru
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	*state = saved
+	return true, nil
+}
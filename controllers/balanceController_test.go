@@ -0,0 +1,409 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"finance-app/database"
+	"finance-app/models"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestAddToBalanceStateMatchesRecompute(t *testing.T) {
+	jan := time.Date(2024, 1, 15, 12, 0, 0, 0, time.Local)
+	feb := time.Date(2024, 2, 3, 12, 0, 0, 0, time.Local)
+	salary := models.Transaction{Type: "income", Amount: 500, Date: jan}
+	rent := models.Transaction{Type: "expense", Amount: 200, Date: jan}
+	food := models.Transaction{Type: "expense", Amount: 30, Date: feb}
+
+	// Delta: tambah tiga transaksi, ubah nominal rent, lalu hapus food
+	var incremental models.BalanceState
+	for _, tx := range []models.Transaction{salary, rent, food} {
+		tx := tx
+		addToBalanceState(&incremental, &tx, 1)
+	}
+	newRent := rent
+	newRent.Amount = 250
+	addToBalanceState(&incremental, &rent, -1)
+	addToBalanceState(&incremental, &newRent, 1)
+	addToBalanceState(&incremental, &food, -1)
+
+	// Hitung ulang dari transaksi yang tersisa
+	var recomputed models.BalanceState
+	for _, tx := range []models.Transaction{salary, newRent} {
+		tx := tx
+		addToBalanceState(&recomputed, &tx, 1)
+	}
+
+	if incremental.TotalIncome != recomputed.TotalIncome || incremental.TotalExpense != recomputed.TotalExpense || incremental.Count != recomputed.Count {
+		t.Fatalf("totals differ: incremental %+v, recomputed %+v", incremental, recomputed)
+	}
+	if got, want := incremental.Months["2024-01"], recomputed.Months["2024-01"]; got != want {
+		t.Fatalf("January differs: incremental %+v, recomputed %+v", got, want)
+	}
+	if got := incremental.Months["2024-02"]; got.Count != 0 || got.TotalExpense != 0 {
+		t.Fatalf("February should be empty after deleting its only transaction, got %+v", got)
+	}
+}
+
+// Test di bawah ini membutuhkan MongoDB. Setel MONGODB_TEST_URI (misalnya
+// mongodb://localhost:27017) untuk menjalankannya; setiap test memakai database sementara.
+func setupTestDatabase(t *testing.T) {
+	t.Helper()
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI is not set")
+	}
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := client.Database("finance_app_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+
+	database.Client = client
+	database.TransactionCollection = db.Collection("transactions")
+	database.CategoryCollection = db.Collection("categories")
+	database.BalanceCollection = db.Collection("balances")
+	database.AuditLogCollection = db.Collection("audit_logs")
+	database.PayeeCollection = db.Collection("payees")
+	database.LedgerCollection = db.Collection("ledgers")
+	database.GroupExpenseCollection = db.Collection("group_expenses")
+	database.GroupSettlementCollection = db.Collection("group_settlements")
+	database.GroupEntryCollection = db.Collection("group_entries")
+	database.GroupPositionCollection = db.Collection("group_positions")
+
+	_, err = database.BalanceCollection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "period", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createTestCategories(t *testing.T, userID primitive.ObjectID) map[string]primitive.ObjectID {
+	t.Helper()
+	categories := make(map[string]primitive.ObjectID)
+	for _, kind := range []string{"income", "expense"} {
+		category := models.Category{ID: primitive.NewObjectID(), Name: kind, Type: kind, UserID: userID}
+		if _, err := database.CategoryCollection.InsertOne(context.Background(), category); err != nil {
+			t.Fatal(err)
+		}
+		categories[kind] = category.ID
+	}
+	return categories
+}
+
+// Fungsi helper untuk memastikan snapshot tersimpan sama dengan hasil hitung ulang dari transaksi
+func assertBalanceSnapshotConsistent(t *testing.T, userID primitive.ObjectID) {
+	t.Helper()
+	stored, err := findBalanceState(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Generation == 0 || stored.Stale {
+		t.Fatalf("snapshot was not rebuilt: %+v", stored)
+	}
+	if len(stored.Writers) != 0 {
+		t.Fatalf("writers were not released: %+v", stored.Writers)
+	}
+	expected, err := computeBalanceState(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.TotalIncome != expected.TotalIncome || stored.TotalExpense != expected.TotalExpense || stored.Count != expected.Count {
+		t.Fatalf("snapshot totals income=%v expense=%v count=%d, transactions give income=%v expense=%v count=%d",
+			stored.TotalIncome, stored.TotalExpense, stored.Count, expected.TotalIncome, expected.TotalExpense, expected.Count)
+	}
+	for period, want := range expected.Months {
+		if got := stored.Months[period]; got != want {
+			t.Fatalf("snapshot for %s is %+v, transactions give %+v", period, got, want)
+		}
+	}
+	for period, got := range stored.Months {
+		if _, ok := expected.Months[period]; !ok && got.Count != 0 {
+			t.Fatalf("snapshot for %s is %+v but it has no transactions", period, got)
+		}
+	}
+}
+
+func TestBalanceSnapshotConcurrentWritesAndRebuilds(t *testing.T) {
+	setupTestDatabase(t)
+	userID := primitive.NewObjectID()
+	categories := createTestCategories(t, userID)
+
+	// Transaksi lama yang sudah ada sebelum snapshot dibangun
+	var seeded []primitive.ObjectID
+	for i := 0; i < 20; i++ {
+		tx := models.Transaction{
+			ID: primitive.NewObjectID(), Type: "expense", CategoryID: categories["expense"],
+			Amount: float64(10 + i), Date: time.Date(2024, time.Month(1+i%6), 10, 0, 0, 0, 0, time.Local),
+			UserID: userID, Version: 1,
+		}
+		if _, err := database.TransactionCollection.InsertOne(context.Background(), tx); err != nil {
+			t.Fatal(err)
+		}
+		seeded = append(seeded, tx.ID)
+	}
+
+	var ids struct {
+		sync.Mutex
+		list []primitive.ObjectID
+	}
+	ids.list = append(ids.list, seeded...)
+	pick := func(rng *rand.Rand) primitive.ObjectID {
+		ids.Lock()
+		defer ids.Unlock()
+		return ids.list[rng.Intn(len(ids.list))]
+	}
+	request := func(method string, id primitive.ObjectID, body interface{}) *http.Request {
+		data, _ := json.Marshal(body)
+		r := httptest.NewRequest(method, "/transactions/"+id.Hex(), bytes.NewReader(data))
+		ctx := context.WithValue(r.Context(), "ledger_id", userID)
+		ctx = context.WithValue(ctx, "user_id", userID)
+		return mux.SetURLVars(r.WithContext(ctx), map[string]string{"id": id.Hex()})
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for i := 0; i < 25; i++ {
+				switch rng.Intn(3) {
+				case 0:
+					kind := []string{"income", "expense"}[rng.Intn(2)]
+					tx := models.Transaction{
+						Type: kind, CategoryID: categories[kind], Amount: float64(1 + rng.Intn(100)),
+						Date: time.Date(2024, time.Month(1+rng.Intn(6)), 1+rng.Intn(27), 0, 0, 0, 0, time.Local),
+					}
+					if err := insertTransaction(userID, userID, &tx); err != nil {
+						errs <- fmt.Errorf("insert: %v", err)
+						return
+					}
+					ids.Lock()
+					ids.list = append(ids.list, tx.ID)
+					ids.Unlock()
+				case 1:
+					body := models.Transaction{Type: "expense", CategoryID: categories["expense"], Amount: float64(1 + rng.Intn(100))}
+					w := httptest.NewRecorder()
+					UpdateTransaction(w, request(http.MethodPut, pick(rng), body))
+					if w.Code != http.StatusOK && w.Code != http.StatusNotFound {
+						errs <- fmt.Errorf("update: %d %s", w.Code, w.Body.String())
+						return
+					}
+				case 2:
+					w := httptest.NewRecorder()
+					DeleteTransaction(w, request(http.MethodDelete, pick(rng), nil))
+					if w.Code != http.StatusOK && w.Code != http.StatusNotFound {
+						errs <- fmt.Errorf("delete: %d %s", w.Code, w.Body.String())
+						return
+					}
+				}
+			}
+		}(int64(worker))
+	}
+
+	// Rebuild berjalan terus selama penulisan, termasuk rebuild dari snapshot stale
+	done := make(chan struct{})
+	var rebuilds sync.WaitGroup
+	rebuilds.Add(1)
+	go func() {
+		defer rebuilds.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			database.BalanceCollection.UpdateOne(context.Background(),
+				bson.M{"user_id": userID, "period": allTimePeriod}, bson.M{"$set": bson.M{"stale": true}})
+			if _, err := loadBalanceState(userID); err != nil {
+				errs <- fmt.Errorf("rebuild: %v", err)
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(done)
+	rebuilds.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// Snapshot bisa saja stale karena goroutine rebuild; bangun ulang sekali tanpa penulisan
+	if _, err := loadBalanceState(userID); err != nil {
+		t.Fatal(err)
+	}
+	assertBalanceSnapshotConsistent(t, userID)
+}
+
+func TestBalanceDeltasWithoutRebuildStayConsistent(t *testing.T) {
+	setupTestDatabase(t)
+	userID := primitive.NewObjectID()
+	categories := createTestCategories(t, userID)
+	if err := RebuildBalanceSnapshots(userID); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 10; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				tx := models.Transaction{
+					Type: "income", CategoryID: categories["income"], Amount: float64(worker + 1),
+					Date: time.Date(2024, time.Month(1+i%12), 5, 0, 0, 0, 0, time.Local),
+				}
+				if err := insertTransaction(userID, userID, &tx); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	assertBalanceSnapshotConsistent(t, userID)
+	state, _ := findBalanceState(userID)
+	if state.Count != 200 || state.TotalIncome != 1100 {
+		t.Fatalf("expected 200 transactions totalling 1100, got %d totalling %v", state.Count, state.TotalIncome)
+	}
+}
+
+func TestBalanceRebuildWaitsForActiveWriter(t *testing.T) {
+	setupTestDatabase(t)
+	userID := primitive.NewObjectID()
+	categories := createTestCategories(t, userID)
+
+	// Transaksi sudah tersimpan tetapi deltanya belum diterapkan
+	release, err := beginBalanceWrite(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := models.Transaction{
+		ID: primitive.NewObjectID(), Type: "expense", CategoryID: categories["expense"],
+		Amount: 40, Date: time.Now(), UserID: userID, Version: 1,
+	}
+	if _, err := database.TransactionCollection.InsertOne(context.Background(), tx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RebuildBalanceSnapshots(userID); err != errBalanceRebuildBusy {
+		t.Fatalf("expected rebuild to be blocked by the active writer, got %v", err)
+	}
+	state, err := loadBalanceState(userID)
+	if err != nil || state.TotalExpense != 40 {
+		t.Fatalf("read during an active write should fall back to the recomputed total 40, got %v (%v)", state.TotalExpense, err)
+	}
+
+	recordTransactionChange(userID, userID, "create", tx.ID, nil, &tx)
+	release()
+
+	if err := RebuildBalanceSnapshots(userID); err != nil {
+		t.Fatal(err)
+	}
+	assertBalanceSnapshotConsistent(t, userID)
+	if state, _ := findBalanceState(userID); state.TotalExpense != 40 {
+		t.Fatalf("transaction counted %v instead of once", state.TotalExpense)
+	}
+}
+
+func TestBalanceRebuildIgnoresExpiredWriter(t *testing.T) {
+	setupTestDatabase(t)
+	userID := primitive.NewObjectID()
+
+	// Penanda dari request yang mati sebelum sempat melepasnya
+	_, err := database.BalanceCollection.InsertOne(context.Background(), bson.M{
+		"user_id": userID,
+		"period":  allTimePeriod,
+		"writers": []models.BalanceWriter{{ID: primitive.NewObjectID(), StartedAt: time.Now().Add(-2 * balanceWriterLease)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RebuildBalanceSnapshots(userID); err != nil {
+		t.Fatal(err)
+	}
+	assertBalanceSnapshotConsistent(t, userID)
+}
+
+func TestBalancePeriodUsesUTCMonths(t *testing.T) {
+	jakarta := time.FixedZone("WIB", 7*3600)
+	tests := []struct {
+		date time.Time
+		want string
+	}{
+		{time.Date(2024, 6, 30, 23, 59, 0, 0, time.UTC), "2024-06"},
+		{time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), "2024-07"},
+		// 1 Juli pukul 03.00 WIB masih 30 Juni di UTC
+		{time.Date(2024, 7, 1, 3, 0, 0, 0, jakarta), "2024-06"},
+		{time.Date(2024, 7, 1, 7, 0, 0, 0, jakarta), "2024-07"},
+	}
+	for _, tt := range tests {
+		if got := balancePeriod(tt.date); got != tt.want {
+			t.Errorf("balancePeriod(%v) = %s, want %s", tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestBalanceAsOfUsesUserTimezone(t *testing.T) {
+	setupTestDatabase(t)
+	userID := primitive.NewObjectID()
+	categories := createTestCategories(t, userID)
+
+	// 30 Juni 20.00 UTC sudah 1 Juli 03.00 di Jakarta
+	tx := models.Transaction{
+		Type: "income", CategoryID: categories["income"], Amount: 100,
+		Date: time.Date(2024, 6, 30, 20, 0, 0, 0, time.UTC),
+	}
+	if err := insertTransaction(userID, userID, &tx); err != nil {
+		t.Fatal(err)
+	}
+
+	for tz, want := range map[string]float64{"UTC": 100, "Asia/Jakarta": 0} {
+		if _, err := time.LoadLocation(tz); err != nil {
+			t.Skipf("time zone data unavailable: %v", err)
+		}
+		r := httptest.NewRequest(http.MethodGet, "/balance?as_of=2024-06-30&tz="+tz, nil)
+		ctx := context.WithValue(r.Context(), "ledger_id", userID)
+		ctx = context.WithValue(ctx, "user_id", userID)
+		w := httptest.NewRecorder()
+		GetCurrentBalance(w, r.WithContext(ctx))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", tz, w.Code, w.Body.String())
+		}
+		var body struct {
+			Balance float64 `json:"balance"`
+		}
+		json.NewDecoder(w.Body).Decode(&body)
+		if body.Balance != want {
+			t.Errorf("as_of 2024-06-30 in %s: balance %v, want %v", tz, body.Balance, want)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"finance-app/database"
+	"finance-app/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxBatchOperations = 500
+
+type batchOperation struct {
+	Op          string             `json:"op"` // "create", "update" atau "delete"
+	ID          string             `json:"id,omitempty"`
+	Version     *int64             `json:"version,omitempty"` // Sama seperti If-Match untuk update dan delete
+	Transaction models.Transaction `json:"transaction"`
+}
+
+type batchRequest struct {
+	Mode       string           `json:"mode"` // "atomic" atau "best_effort" (default)
+	Operations []batchOperation `json:"operations"`
+}
+
+type batchResult struct {
+	Index   int    `json:"index"`
+	Op      string `json:"op"`
+	ID      string `json:"id,omitempty"`
+	Status  int    `json:"status"`
+	Version int64  `json:"version,omitempty"` // Versi dokumen setelah operasi berhasil
+	Error   string `json:"error,omitempty"`
+}
+
+// Operasi batch yang sudah divalidasi dan siap ditulis
+type preparedOperation struct {
+	index       int
+	op          string
+	id          primitive.ObjectID
+	version     *int64             // Versi yang diharapkan (update dan delete)
+	transaction models.Transaction // Dokumen baru (create) atau field update (update)
+	before      models.Transaction // Dokumen lama (update dan delete)
+}
+
+var (
+	errBatchItemNotFound = errors.New("Transaction not found or not owned by user")
+	errFutureImportDate  = errors.New("Imported transaction date must not be in the future")
+)
+
+// BatchTransactions menjalankan banyak operasi create/update/delete sekaligus.
+// Mode "atomic" memakai multi-document transaction MongoDB (semua berhasil atau tidak
+// ada yang ditulis), sedangkan "best_effort" menulis setiap item sendiri dan melaporkan hasil
+// per item.
+func BatchTransactions(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	var request batchRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Mode == "" {
+		request.Mode = "best_effort"
+	}
+	if request.Mode != "atomic" && request.Mode != "best_effort" {
+		http.Error(w, "Invalid mode. Must be 'atomic' or 'best_effort'", http.StatusBadRequest)
+		return
+	}
+	if len(request.Operations) == 0 || len(request.Operations) > maxBatchOperations {
+		http.Error(w, "Batch must contain between 1 and 500 operations", http.StatusBadRequest)
+		return
+	}
+
+	writeBatch(w, actorID, ledgerID, request, false)
+}
+
+// ImportTransactions menyimpan transaksi hasil impor (misalnya dari mutasi rekening) dalam
+// satu batch create. Aturan otomatis dan payee diterapkan ke setiap baris seperti pada
+// POST /transactions/import/preview, dan berbeda dengan create biasa, tanggal asli dari
+// file impor dipertahankan.
+func ImportTransactions(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	var request struct {
+		Mode         string               `json:"mode"`
+		Transactions []models.Transaction `json:"transactions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Mode == "" {
+		request.Mode = "best_effort"
+	}
+	if request.Mode != "atomic" && request.Mode != "best_effort" {
+		http.Error(w, "Invalid mode. Must be 'atomic' or 'best_effort'", http.StatusBadRequest)
+		return
+	}
+	if len(request.Transactions) == 0 || len(request.Transactions) > maxBatchOperations {
+		http.Error(w, "transactions must contain between 1 and 500 items", http.StatusBadRequest)
+		return
+	}
+
+	batch := batchRequest{Mode: request.Mode, Operations: make([]batchOperation, len(request.Transactions))}
+	for i, transaction := range request.Transactions {
+		batch.Operations[i] = batchOperation{Op: "create", Transaction: transaction}
+	}
+	writeBatch(w, actorID, ledgerID, batch, true)
+}
+
+// Fungsi helper untuk memvalidasi, menulis dan melaporkan hasil batch yang sudah diperiksa
+// mode dan jumlah operasinya. keepDates mempertahankan tanggal item create (impor).
+func writeBatch(w http.ResponseWriter, actorID, ledgerID primitive.ObjectID, request batchRequest, keepDates bool) {
+	results := make([]batchResult, len(request.Operations))
+	prepared, ok, err := prepareBatch(actorID, ledgerID, request.Operations, results, keepDates)
+	if err != nil {
+		http.Error(w, "Error validating batch", http.StatusInternalServerError)
+		return
+	}
+
+	releaseBalance, err := beginBalanceWrite(ledgerID)
+	if err != nil {
+		http.Error(w, "Error preparing balance snapshot", http.StatusInternalServerError)
+		return
+	}
+	defer releaseBalance()
+
+	status := http.StatusOK
+	if request.Mode == "atomic" {
+		if !ok {
+			markSkipped(results, "Not applied because another operation in the batch is invalid")
+			status = http.StatusBadRequest
+			prepared = nil
+		} else if err := runAtomicBatch(ledgerID, prepared); err != nil {
+			if err == errTransactionChanged {
+				status = http.StatusConflict
+			} else {
+				status = http.StatusInternalServerError
+			}
+			for _, p := range prepared {
+				results[p.index].Status = status
+				results[p.index].Error = "Batch aborted: " + err.Error()
+			}
+			prepared = nil
+		} else {
+			for _, p := range prepared {
+				setBatchSuccess(results, p)
+			}
+		}
+	} else {
+		prepared, err = runBestEffortBatch(ledgerID, prepared, results)
+		if err != nil {
+			http.Error(w, "Error writing batch", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Catat audit untuk operasi yang berhasil
+	for i := range prepared {
+		p := &prepared[i]
+		switch p.op {
+		case "create":
+			recordTransactionChange(actorID, ledgerID, "create", p.id, nil, &p.transaction)
+		case "update":
+			after := applyTransactionUpdate(p.before, p.transaction)
+			recordTransactionChange(actorID, ledgerID, "update", p.id, &p.before, &after)
+		case "delete":
+			recordTransactionChange(actorID, ledgerID, "delete", p.id, &p.before, nil)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mode":    request.Mode,
+		"results": results,
+	})
+}
+
+// Fungsi helper untuk memvalidasi setiap operasi. Item yang tidak valid langsung diisi
+// hasil error-nya; ok bernilai false jika ada satu saja item yang tidak valid.
+func prepareBatch(actorID, userID primitive.ObjectID, operations []batchOperation, results []batchResult, keepDates bool) ([]preparedOperation, bool, error) {
+	var prepared []preparedOperation
+	ok := true
+	fail := func(i int, status int, message string) {
+		results[i].Status = status
+		results[i].Error = message
+		ok = false
+	}
+
+	var existingIDs []primitive.ObjectID
+	var rules []activeRule
+	var payees []models.Payee
+	rulesLoaded := false
+	seen := make(map[primitive.ObjectID]bool)
+	for i, operation := range operations {
+		results[i] = batchResult{Index: i, Op: operation.Op, ID: operation.ID}
+		p := preparedOperation{index: i, op: operation.Op, version: operation.Version, transaction: operation.Transaction}
+
+		switch operation.Op {
+		case "create":
+			p.id = primitive.NewObjectID()
+			p.transaction.ID = p.id
+			p.transaction.UserID = userID
+			p.transaction.CreatedBy = &actorID
+			p.transaction.DeletedAt, p.transaction.DeletedWith = nil, nil
+			p.transaction.DebtID = nil
+			p.transaction.InstallmentPlanID, p.transaction.InstallmentNumber = nil, 0
+			p.transaction.Version = 1
+			// Sama seperti CreateTransaction, tanggal diisi server kecuali untuk impor
+			if !keepDates || p.transaction.Date.IsZero() {
+				p.transaction.Date = time.Now()
+			} else if p.transaction.Date.After(time.Now()) {
+				fail(i, http.StatusBadRequest, errFutureImportDate.Error())
+				continue
+			}
+			// Aturan otomatis dan payee dimuat sekali untuk seluruh batch
+			if !rulesLoaded {
+				var err error
+				if rules, err = loadActiveRules(userID); err != nil {
+					return nil, false, err
+				}
+				if payees, err = loadActivePayees(userID); err != nil {
+					return nil, false, err
+				}
+				rulesLoaded = true
+			}
+			applyRules(rules, &p.transaction, false)
+			applyPayee(payees, &p.transaction)
+			results[i].ID = p.id.Hex()
+		case "update", "delete":
+			id, err := primitive.ObjectIDFromHex(operation.ID)
+			if err != nil {
+				fail(i, http.StatusBadRequest, "Invalid transaction ID")
+				continue
+			}
+			if seen[id] {
+				fail(i, http.StatusBadRequest, "Transaction ID appears more than once in the batch")
+				continue
+			}
+			seen[id] = true
+			p.id = id
+			existingIDs = append(existingIDs, id)
+		default:
+			fail(i, http.StatusBadRequest, "Invalid op. Must be 'create', 'update' or 'delete'")
+			continue
+		}
+
+		if p.op != "delete" {
+			if err := validateTransaction(userID, &p.transaction); err != nil {
+				if !isValidationError(err) {
+					return nil, false, err
+				}
+				fail(i, http.StatusBadRequest, err.Error())
+				continue
+			}
+		}
+		prepared = append(prepared, p)
+	}
+
+	// Ambil dokumen lama untuk update dan delete sekaligus
+	existing := make(map[primitive.ObjectID]models.Transaction)
+	if len(existingIDs) > 0 {
+		transactions, err := findTransactions(bson.M{"_id": bson.M{"$in": existingIDs}, "user_id": userID, "deleted_at": nil})
+		if err != nil {
+			return nil, false, err
+		}
+		for _, transaction := range transactions {
+			existing[transaction.ID] = transaction
+		}
+	}
+
+	valid := prepared[:0]
+	for _, p := range prepared {
+		if p.op != "create" {
+			before, found := existing[p.id]
+			if !found {
+				fail(p.index, http.StatusNotFound, errBatchItemNotFound.Error())
+				continue
+			}
+			if p.version != nil && *p.version != before.Version {
+				fail(p.index, http.StatusPreconditionFailed, errVersionMismatch.Error())
+				continue
+			}
+			if !debtWriteAllowed(before, batchUpdate(p)) {
+				fail(p.index, http.StatusConflict, errDebtLinkedTransaction.Error())
+				continue
+			}
+			p.before = before
+		}
+		valid = append(valid, p)
+	}
+	return valid, ok, nil
+}
+
+// Fungsi helper untuk menulis semua operasi dalam satu multi-document transaction. Dokumen
+// lama untuk update dan delete diambil ulang di dalam transaksi agar audit dan snapshot saldo
+// memakai isi dokumen yang benar-benar diganti.
+func runAtomicBatch(userID primitive.ObjectID, prepared []preparedOperation) error {
+	session, err := database.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+
+	_, err = session.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+		now := time.Now()
+		for i := range prepared {
+			p := &prepared[i]
+			if p.op == "create" {
+				if _, err := database.TransactionCollection.InsertOne(sessCtx, p.transaction); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			before, err := writeBatchItem(sessCtx, userID, *p, now)
+			if err != nil {
+				return nil, err
+			}
+			p.before = before
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// Fungsi helper untuk menulis operasi tanpa transaksi dengan satu BulkWrite dan melaporkan
+// hasil per item. Update dan delete hanya cocok dengan versi yang dibaca saat validasi, sehingga
+// dokumen lama yang diganti pasti sama dengan p.before; item yang berubah atau terhapus sejak
+// validasi dilaporkan 409. Mengembalikan operasi yang berhasil ditulis.
+func runBestEffortBatch(userID primitive.ObjectID, prepared []preparedOperation, results []batchResult) ([]preparedOperation, error) {
+	if len(prepared) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	writeIDs := make(map[int]primitive.ObjectID)
+	writeModels := make([]mongo.WriteModel, 0, len(prepared))
+	for i, p := range prepared {
+		if p.op == "create" {
+			writeModels = append(writeModels, mongo.NewInsertOneModel().SetDocument(p.transaction))
+			continue
+		}
+		writeIDs[i] = primitive.NewObjectID()
+		writeModels = append(writeModels, mongo.NewUpdateOneModel().
+			SetFilter(batchFilter(userID, p)).
+			SetUpdate(batchWriteUpdate(p, now, writeIDs[i])))
+	}
+
+	failed := make(map[int]string)
+	result, err := database.TransactionCollection.BulkWrite(context.Background(), writeModels, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 {
+			return nil, err
+		}
+		for _, writeErr := range bulkErr.WriteErrors {
+			failed[writeErr.Index] = writeErr.Message
+		}
+	}
+
+	// Jika jumlah dokumen yang cocok kurang dari jumlah update dan delete yang tidak error,
+	// cari item mana yang benar-benar menulis lewat write_id-nya
+	changed := make(map[int]bool)
+	expected := int64(0)
+	for i := range writeIDs {
+		if _, ok := failed[i]; !ok {
+			expected++
+		}
+	}
+	if result != nil && result.MatchedCount < expected {
+		var ids []primitive.ObjectID
+		for i := range writeIDs {
+			ids = append(ids, writeIDs[i])
+		}
+		matched, err := findTransactions(bson.M{"write_id": bson.M{"$in": ids}})
+		if err != nil {
+			return nil, err
+		}
+		applied := make(map[primitive.ObjectID]bool)
+		for _, transaction := range matched {
+			applied[*transaction.WriteID] = true
+		}
+		for i, writeID := range writeIDs {
+			if _, ok := failed[i]; !ok && !applied[writeID] {
+				changed[i] = true
+			}
+		}
+	}
+
+	var written []preparedOperation
+	for i, p := range prepared {
+		if message, ok := failed[i]; ok {
+			results[p.index].Status = http.StatusInternalServerError
+			results[p.index].Error = message
+			continue
+		}
+		if changed[i] {
+			results[p.index].Status = http.StatusConflict
+			results[p.index].Error = errTransactionChanged.Error()
+			continue
+		}
+		setBatchSuccess(results, p)
+		written = append(written, p)
+	}
+	return written, nil
+}
+
+// Fungsi helper untuk isi update item batch: soft delete untuk delete, field baru untuk update
+func batchWriteUpdate(p preparedOperation, now time.Time, writeID primitive.ObjectID) bson.M {
+	set := bson.M{"deleted_at": now}
+	if p.op == "update" {
+		set = transactionUpdateFields(p.transaction)
+	}
+	if !writeID.IsZero() {
+		set["write_id"] = writeID
+	}
+	return bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+}
+
+// Fungsi helper untuk menulis satu update atau delete dan mengembalikan dokumen sebelum
+// ditulis. errTransactionChanged berarti tidak ada dokumen yang cocok lagi.
+func writeBatchItem(ctx context.Context, userID primitive.ObjectID, p preparedOperation, now time.Time) (models.Transaction, error) {
+	var before models.Transaction
+	err := database.TransactionCollection.FindOneAndUpdate(ctx, batchFilter(userID, p), batchWriteUpdate(p, now, primitive.NilObjectID)).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		return before, errTransactionChanged
+	}
+	return before, err
+}
+
+// Fungsi helper untuk filter update dan delete batch. Versi selalu dikunci ke versi yang
+// dibaca saat validasi (yang sudah dicocokkan dengan version dari klien jika ada).
+func batchFilter(userID primitive.ObjectID, p preparedOperation) bson.M {
+	filter := bson.M{"_id": p.id, "user_id": userID, "deleted_at": nil, "version": versionFilter(p.before.Version)}
+	addDebtWriteCondition(filter, batchUpdate(p))
+	return filter
+}
+
+// Fungsi helper untuk isi update item, nil untuk delete
+func batchUpdate(p preparedOperation) *models.Transaction {
+	if p.op == "update" {
+		return &p.transaction
+	}
+	return nil
+}
+
+func setBatchSuccess(results []batchResult, p preparedOperation) {
+	if p.op == "create" {
+		results[p.index].Status = http.StatusCreated
+		results[p.index].Version = p.transaction.Version
+		return
+	}
+	results[p.index].Status = http.StatusOK
+	results[p.index].Version = p.before.Version + 1
+}
+
+func markSkipped(results []batchResult, message string) {
+	for i := range results {
+		if results[i].Error == "" {
+			results[i].Status = http.StatusFailedDependency
+			results[i].Error = message
+		}
+	}
+}
@@ -2,93 +2,361 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"finance-app/database"
+	"finance-app/models"
+	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+)
 
-	"finance-app/models"
+var (
+	errCategoryNotFound     = errors.New("Category not found or not owned by user")
+	errCategoryTypeMismatch = errors.New("Category type does not match transaction type")
 )
 
-func createCategory(category models.Category) error {
-	// Koneksi ke MongoDB
-	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017")
-	client, err := mongo.Connect(context.TODO(), clientOptions)
+func CreateCategory(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	var category models.Category
+	err := json.NewDecoder(r.Body).Decode(&category)
 	if err != nil {
-		return err
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	defer client.Disconnect(context.TODO())
+	category.ID = primitive.NewObjectID()
+	category.UserID = ledgerID // Set user ID pada kategori
 
-	collection := client.Database("finance_app").Collection("categories")
+	// Validasi tipe kategori
+	if category.Type != "income" && category.Type != "expense" {
+		http.Error(w, "Invalid category type. Must be 'income' or 'expense'", http.StatusBadRequest)
+		return
+	}
 
-	_, err = collection.InsertOne(context.TODO(), category)
-	return err
+	result, err := database.CategoryCollection.InsertOne(context.Background(), category)
+	if err != nil {
+		http.Error(w, "Error creating category", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(actorID, ledgerID, "categories", "create", category.ID, nil, &category)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"inserted_id": result.InsertedID})
 }
 
-func getCategories() ([]models.Category, error) {
-	// Koneksi ke MongoDB
-	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017")
-	client, err := mongo.Connect(context.TODO(), clientOptions)
+func GetCategories(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	cursor, err := database.CategoryCollection.Find(context.Background(), bson.M{"user_id": ledgerID, "deleted_at": nil})
 	if err != nil {
-		return nil, err
+		http.Error(w, "Error fetching categories", http.StatusInternalServerError)
+		return
 	}
-	defer client.Disconnect(context.TODO())
+	defer cursor.Close(context.Background())
+
+	var categories []models.Category
+	if err = cursor.All(context.Background(), &categories); err != nil {
+		http.Error(w, "Error decoding categories", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories)
+}
 
-	collection := client.Database("finance_app").Collection("categories")
+func UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
 
-	cursor, err := collection.Find(context.TODO(), bson.M{})
+	params := mux.Vars(r)
+	categoryID, err := primitive.ObjectIDFromHex(params["id"])
 	if err != nil {
-		return nil, err
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
 	}
-	defer cursor.Close(context.TODO())
 
-	var categories []models.Category
-	for cursor.Next(context.TODO()) {
-		var category models.Category
-		err := cursor.Decode(&category)
+	var category models.Category
+	err = json.NewDecoder(r.Body).Decode(&category)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validasi tipe kategori
+	if category.Type != "income" && category.Type != "expense" {
+		http.Error(w, "Invalid category type. Must be 'income' or 'expense'", http.StatusBadRequest)
+		return
+	}
+
+	var existing models.Category
+	err = database.CategoryCollection.FindOne(context.Background(), bson.M{"_id": categoryID, "user_id": ledgerID, "deleted_at": nil}).Decode(&existing)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, errCategoryNotFound.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, "Error finding category", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Tipe kategori tidak boleh diubah jika masih dipakai transaksi dengan tipe lama
+	if existing.Type != category.Type {
+		count, err := database.TransactionCollection.CountDocuments(context.Background(), categoryUsageFilter(ledgerID, categoryID))
 		if err != nil {
-			return nil, err
+			http.Error(w, "Error checking category usage", http.StatusInternalServerError)
+			return
+		}
+		if count > 0 {
+			http.Error(w, "Cannot change type of a category that is used by transactions", http.StatusConflict)
+			return
 		}
-		categories = append(categories, category)
 	}
 
-	if err := cursor.Err(); err != nil {
-		return nil, err
+	filter := bson.M{"_id": categoryID, "user_id": ledgerID, "deleted_at": nil}
+	update := bson.M{"$set": bson.M{
+		"name":        category.Name,
+		"description": category.Description,
+		"type":        category.Type,
+	}}
+	_, err = database.CategoryCollection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		http.Error(w, "Error updating category", http.StatusInternalServerError)
+		return
 	}
 
-	return categories, nil
+	after := existing
+	after.Name = category.Name
+	after.Description = category.Description
+	after.Type = category.Type
+	recordAudit(actorID, ledgerID, "categories", "update", categoryID, &existing, &after)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Category updated successfully"})
 }
 
-func updateCategory(id primitive.ObjectID, update bson.M) error {
-	// Koneksi ke MongoDB
-	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017")
-	client, err := mongo.Connect(context.TODO(), clientOptions)
+// DeleteCategory memindahkan kategori milik user ke tempat sampah. Jika kategori masih
+// dipakai transaksi, request harus menyertakan ?reassign_to=<id kategori lain> untuk
+// memindahkan transaksi tersebut, atau ?cascade=true untuk ikut menghapusnya.
+func DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	params := mux.Vars(r)
+	categoryID, err := primitive.ObjectIDFromHex(params["id"])
 	if err != nil {
-		return err
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	reassignTo := r.URL.Query().Get("reassign_to")
+	cascade := r.URL.Query().Get("cascade") == "true"
+	if reassignTo != "" && cascade {
+		http.Error(w, "Use either reassign_to or cascade, not both", http.StatusBadRequest)
+		return
+	}
+
+	var category models.Category
+	err = database.CategoryCollection.FindOne(context.Background(), bson.M{"_id": categoryID, "user_id": ledgerID, "deleted_at": nil}).Decode(&category)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, errCategoryNotFound.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, "Error finding category", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	txFilter := categoryUsageFilter(ledgerID, categoryID)
+	count, err := database.TransactionCollection.CountDocuments(context.Background(), txFilter)
+	if err != nil {
+		http.Error(w, "Error checking category usage", http.StatusInternalServerError)
+		return
 	}
-	defer client.Disconnect(context.TODO())
 
-	collection := client.Database("finance_app").Collection("categories")
+	if count > 0 {
+		releaseBalance, err := beginBalanceWrite(ledgerID)
+		if err != nil {
+			http.Error(w, "Error preparing balance snapshot", http.StatusInternalServerError)
+			return
+		}
+		defer releaseBalance()
+	}
 
-	filter := bson.M{"_id": id}
+	// Kategori dan transaksinya dipindahkan ke tempat sampah, bukan dihapus permanen
+	now := time.Now()
+	var affected int64
+	switch {
+	case count == 0:
+		// Tidak ada transaksi, kategori bisa langsung dihapus
+	case reassignTo != "":
+		targetID, err := primitive.ObjectIDFromHex(reassignTo)
+		if err != nil || targetID == categoryID {
+			http.Error(w, "Invalid reassign_to category ID", http.StatusBadRequest)
+			return
+		}
+		if err := checkTransactionCategory(ledgerID, targetID, category.Type); err != nil {
+			if err == errCategoryNotFound || err == errCategoryTypeMismatch {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				http.Error(w, "Error validating category", http.StatusInternalServerError)
+			}
+			return
+		}
+		transactions, err := findTransactions(txFilter)
+		if err != nil {
+			http.Error(w, "Error finding category transactions", http.StatusInternalServerError)
+			return
+		}
+		result, err := database.TransactionCollection.UpdateMany(context.Background(),
+			bson.M{"category_id": categoryID, "user_id": ledgerID, "deleted_at": nil},
+			bson.M{"$set": bson.M{"category_id": targetID}, "$inc": bson.M{"version": 1}})
+		if err != nil {
+			http.Error(w, "Error reassigning transactions", http.StatusInternalServerError)
+			return
+		}
+		affected = result.ModifiedCount
 
-	_, err = collection.UpdateOne(context.TODO(), filter, bson.M{"$set": update})
-	return err
+		// Pindahkan juga baris split yang memakai kategori ini
+		opts := options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"s.category_id": categoryID}},
+		})
+		result, err = database.TransactionCollection.UpdateMany(context.Background(),
+			bson.M{"splits.category_id": categoryID, "user_id": ledgerID, "deleted_at": nil},
+			bson.M{"$set": bson.M{"splits.$[s].category_id": targetID}, "$inc": bson.M{"version": 1}}, opts)
+		if err != nil {
+			http.Error(w, "Error reassigning transactions", http.StatusInternalServerError)
+			return
+		}
+		affected += result.ModifiedCount
+
+		for i := range transactions {
+			before := transactions[i]
+			after := reassignTransactionCategory(before, categoryID, targetID)
+			recordTransactionChange(actorID, ledgerID, "update", before.ID, &before, &after)
+		}
+	case cascade:
+		// Transaksi split yang memakai kategori ini ikut terhapus seluruhnya
+		transactions, err := findTransactions(txFilter)
+		if err != nil {
+			http.Error(w, "Error finding category transactions", http.StatusInternalServerError)
+			return
+		}
+		// Pembayaran hutang harus dihapus dari hutangnya lebih dulu agar hutang tetap sinkron
+		for _, transaction := range transactions {
+			if !debtWriteAllowed(transaction, nil) {
+				http.Error(w, "Category has debt repayment transactions; delete those repayments first or use reassign_to", http.StatusConflict)
+				return
+			}
+		}
+
+		// Ditulis satu per satu agar audit dan snapshot saldo memakai dokumen yang benar-benar
+		// dihapus, dan transaksi yang ditautkan ke hutang sejak dicek tidak ikut terhapus
+		for _, transaction := range transactions {
+			filter := bson.M{"_id": transaction.ID, "user_id": ledgerID, "deleted_at": nil}
+			addDebtWriteCondition(filter, nil)
+			var deleted models.Transaction
+			err := database.TransactionCollection.FindOneAndUpdate(context.Background(), filter,
+				bson.M{"$set": bson.M{"deleted_at": now, "deleted_with": categoryID}, "$inc": bson.M{"version": 1}}).Decode(&deleted)
+			if err == mongo.ErrNoDocuments {
+				continue
+			} else if err != nil {
+				http.Error(w, "Error deleting category transactions", http.StatusInternalServerError)
+				return
+			}
+			recordTransactionChange(actorID, ledgerID, "delete", deleted.ID, &deleted, nil)
+			affected++
+		}
+	default:
+		http.Error(w, "Category is used by transactions; specify reassign_to or cascade=true", http.StatusConflict)
+		return
+	}
+
+	_, err = database.CategoryCollection.UpdateOne(context.Background(),
+		bson.M{"_id": categoryID, "user_id": ledgerID},
+		bson.M{"$set": bson.M{"deleted_at": now}})
+	if err != nil {
+		http.Error(w, "Error deleting category", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(actorID, ledgerID, "categories", "delete", categoryID, &category, nil)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":               "Category deleted successfully",
+		"affected_transactions": affected,
+	})
 }
 
-func deleteCategory(id primitive.ObjectID) error {
-	// Koneksi ke MongoDB
-	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017")
-	client, err := mongo.Connect(context.TODO(), clientOptions)
+// Fungsi helper untuk memastikan kategori ada, milik user, dan bertipe sama dengan transaksi
+func checkTransactionCategory(userID, categoryID primitive.ObjectID, transactionType string) error {
+	var category models.Category
+	err := database.CategoryCollection.FindOne(context.Background(), bson.M{"_id": categoryID, "user_id": userID, "deleted_at": nil}).Decode(&category)
 	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errCategoryNotFound
+		}
 		return err
 	}
-	defer client.Disconnect(context.TODO())
 
-	collection := client.Database("finance_app").Collection("categories")
+	if category.Type != transactionType {
+		return errCategoryTypeMismatch
+	}
+	return nil
+}
+
+// Fungsi helper untuk filter transaksi yang memakai kategori, baik sebagai kategori induk maupun di baris split
+func categoryUsageFilter(userID, categoryID primitive.ObjectID) bson.M {
+	return bson.M{
+		"user_id":    userID,
+		"deleted_at": nil,
+		"$or": bson.A{
+			bson.M{"category_id": categoryID},
+			bson.M{"splits.category_id": categoryID},
+		},
+	}
+}
+
+// Fungsi helper untuk mengambil transaksi yang cocok dengan filter
+func findTransactions(filter bson.M) ([]models.Transaction, error) {
+	cursor, err := database.TransactionCollection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
 
-	filter := bson.M{"_id": id}
+	var transactions []models.Transaction
+	if err = cursor.All(context.Background(), &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
 
-	_, err = collection.DeleteOne(context.TODO(), filter)
-	return err
+// Fungsi helper untuk menyalin transaksi dengan kategori lama diganti kategori baru
+func reassignTransactionCategory(transaction models.Transaction, from, to primitive.ObjectID) models.Transaction {
+	if transaction.CategoryID == from {
+		transaction.CategoryID = to
+	}
+	if len(transaction.Splits) > 0 {
+		splits := make([]models.TransactionSplit, len(transaction.Splits))
+		copy(splits, transaction.Splits)
+		for i := range splits {
+			if splits[i].CategoryID == from {
+				splits[i].CategoryID = to
+			}
+		}
+		transaction.Splits = splits
+	}
+	transaction.Version++
+	return transaction
 }
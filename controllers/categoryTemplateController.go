@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"finance-app/database"
+	"finance-app/models"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultLocale = "id"
+
+// Template bawaan yang dipakai jika admin belum menyimpan template di database
+var defaultCategoryTemplates = map[string][]models.TemplateCategory{
+	"id": {
+		{Name: "Gaji", Description: "Pendapatan bulanan dari pekerjaan utama", Type: "income"},
+		{Name: "Tunjangan", Description: "Tunjangan tambahan dari pekerjaan", Type: "income"},
+		{Name: "Bonus", Description: "Bonus tahunan atau insentif lainnya", Type: "income"},
+		{Name: "Sewa Kost", Description: "Biaya sewa kost bulanan", Type: "expense"},
+		{Name: "Makan", Description: "Biaya makan sehari-hari", Type: "expense"},
+		{Name: "Pakaian", Description: "Biaya pembelian pakaian", Type: "expense"},
+		{Name: "Nonton Bioskop", Description: "Biaya menonton film di bioskop", Type: "expense"},
+	},
+	"en": {
+		{Name: "Salary", Description: "Monthly income from your main job", Type: "income"},
+		{Name: "Allowance", Description: "Additional work allowances", Type: "income"},
+		{Name: "Bonus", Description: "Annual bonus or other incentives", Type: "income"},
+		{Name: "Rent", Description: "Monthly rent", Type: "expense"},
+		{Name: "Food", Description: "Daily meals", Type: "expense"},
+		{Name: "Clothing", Description: "Clothing purchases", Type: "expense"},
+		{Name: "Movies", Description: "Cinema tickets", Type: "expense"},
+	},
+}
+
+func isSupportedLocale(locale string) bool {
+	_, ok := defaultCategoryTemplates[locale]
+	return ok
+}
+
+// Fungsi helper untuk mengambil template kategori, dengan fallback ke template bawaan
+func getCategoryTemplate(locale string) (models.CategoryTemplate, error) {
+	var template models.CategoryTemplate
+	err := database.CategoryTemplateCollection.FindOne(context.Background(), bson.M{"_id": locale}).Decode(&template)
+	if err == mongo.ErrNoDocuments {
+		return models.CategoryTemplate{Locale: locale, Categories: defaultCategoryTemplates[locale]}, nil
+	}
+	return template, err
+}
+
+// Fungsi helper untuk menyalin template kategori ke akun user baru
+func seedDefaultCategories(userID primitive.ObjectID, locale string) error {
+	template, err := getCategoryTemplate(locale)
+	if err != nil {
+		return err
+	}
+	if len(template.Categories) == 0 {
+		return nil
+	}
+
+	categories := make([]interface{}, 0, len(template.Categories))
+	for _, c := range template.Categories {
+		categories = append(categories, models.Category{
+			Name:        c.Name,
+			Description: c.Description,
+			Type:        c.Type,
+			UserID:      userID,
+		})
+	}
+
+	_, err = database.CategoryCollection.InsertMany(context.Background(), categories)
+	return err
+}
+
+func GetCategoryTemplate(w http.ResponseWriter, r *http.Request) {
+	locale := mux.Vars(r)["locale"]
+	if !isSupportedLocale(locale) {
+		http.Error(w, "Unsupported locale. Must be 'id' or 'en'", http.StatusBadRequest)
+		return
+	}
+
+	template, err := getCategoryTemplate(locale)
+	if err != nil {
+		http.Error(w, "Error fetching category template", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+func UpdateCategoryTemplate(w http.ResponseWriter, r *http.Request) {
+	locale := mux.Vars(r)["locale"]
+	if !isSupportedLocale(locale) {
+		http.Error(w, "Unsupported locale. Must be 'id' or 'en'", http.StatusBadRequest)
+		return
+	}
+
+	var template models.CategoryTemplate
+	err := json.NewDecoder(r.Body).Decode(&template)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	template.Locale = locale
+
+	// Validasi setiap kategori pada template
+	for _, c := range template.Categories {
+		if c.Name == "" {
+			http.Error(w, "Category name is required", http.StatusBadRequest)
+			return
+		}
+		if c.Type != "income" && c.Type != "expense" {
+			http.Error(w, "Invalid category type. Must be 'income' or 'expense'", http.StatusBadRequest)
+			return
+		}
+	}
+
+	opts := options.Replace().SetUpsert(true)
+	_, err = database.CategoryTemplateCollection.ReplaceOne(context.Background(), bson.M{"_id": locale}, template, opts)
+	if err != nil {
+		http.Error(w, "Error updating category template", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Category template updated successfully"})
+}
@@ -0,0 +1,661 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"finance-app/database"
+	"finance-app/models"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errDebtNotFound          = errors.New("Debt not found or not owned by user")
+	errInvalidDebt           = errors.New("Debt needs a counterparty, a direction of 'payable' or 'receivable' and a positive principal")
+	errInvalidRepayment      = errors.New("Repayment amount must be positive and not exceed the outstanding balance")
+	errRepaymentTransaction  = errors.New("Repayment transaction must be an active, unlinked expense (payable) or income (receivable) with the same amount")
+	errPrincipalBelowRepaid  = errors.New("Principal cannot be lower than the amount already repaid")
+	errDebtLinkChanged       = errors.New("Repayment transaction was deleted or linked to another debt by another request")
+	errDebtLinkedTransaction = errors.New("Transaction is a debt repayment; delete the repayment first or keep its type and amount")
+)
+
+func CreateDebt(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	var debt models.Debt
+	if err := json.NewDecoder(r.Body).Decode(&debt); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	debt.ID = primitive.NewObjectID()
+	debt.UserID = ledgerID
+	debt.Repaid = 0
+	debt.Repayments = []models.DebtRepayment{}
+	debt.SettledAt = nil
+	debt.CreatedAt = time.Now()
+
+	if err := validateDebt(&debt); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := database.DebtCollection.InsertOne(context.Background(), debt); err != nil {
+		http.Error(w, "Error creating debt", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(debt)
+}
+
+// GetDebts mengembalikan hutang dan piutang, dengan filter opsional ?direction= dan
+// ?status=open|settled
+func GetDebts(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	filter := bson.M{"user_id": ledgerID}
+	switch direction := r.URL.Query().Get("direction"); direction {
+	case "":
+	case "payable", "receivable":
+		filter["direction"] = direction
+	default:
+		http.Error(w, "Invalid direction. Must be 'payable' or 'receivable'", http.StatusBadRequest)
+		return
+	}
+	switch r.URL.Query().Get("status") {
+	case "":
+	case "open":
+		filter["settled_at"] = nil
+	case "settled":
+		filter["settled_at"] = bson.M{"$ne": nil}
+	default:
+		http.Error(w, "Invalid status. Must be 'open' or 'settled'", http.StatusBadRequest)
+		return
+	}
+
+	writeDebts(w, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+}
+
+// GetOverdueDebts mengembalikan hutang dan piutang yang belum lunas dan sudah lewat
+// jatuh tempo, dimulai dari yang paling lama
+func GetOverdueDebts(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	filter := bson.M{"user_id": ledgerID, "settled_at": nil, "due_date": bson.M{"$lt": time.Now()}}
+	writeDebts(w, filter, options.Find().SetSort(bson.D{{Key: "due_date", Value: 1}}))
+}
+
+func writeDebts(w http.ResponseWriter, filter bson.M, opts *options.FindOptions) {
+	cursor, err := database.DebtCollection.Find(context.Background(), filter, opts)
+	if err != nil {
+		http.Error(w, "Error fetching debts", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	debts := []models.Debt{}
+	if err = cursor.All(context.Background(), &debts); err != nil {
+		http.Error(w, "Error decoding debts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(debts)
+}
+
+// GetDebtSummary menghitung sisa hutang dan piutang yang belum lunas, total per arah dan
+// per counterparty
+func GetDebtSummary(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	outstanding := bson.M{"$subtract": bson.A{"$principal", "$repaid"}}
+	overdue := bson.M{"$cond": bson.A{
+		bson.M{"$and": bson.A{
+			bson.M{"$ne": bson.A{bson.M{"$ifNull": bson.A{"$due_date", nil}}, nil}},
+			bson.M{"$lt": bson.A{"$due_date", time.Now()}},
+		}},
+		1, 0,
+	}}
+	pipeline := []bson.M{
+		{"$match": bson.M{"user_id": ledgerID, "settled_at": nil}},
+		{"$facet": bson.M{
+			"by_direction": []bson.M{
+				{"$group": bson.M{
+					"_id":         "$direction",
+					"principal":   bson.M{"$sum": "$principal"},
+					"repaid":      bson.M{"$sum": "$repaid"},
+					"outstanding": bson.M{"$sum": outstanding},
+					"count":       bson.M{"$sum": 1},
+					"overdue":     bson.M{"$sum": overdue},
+				}},
+			},
+			"by_counterparty": []bson.M{
+				{"$group": bson.M{
+					"_id":         bson.M{"counterparty": "$counterparty", "direction": "$direction"},
+					"outstanding": bson.M{"$sum": outstanding},
+					"count":       bson.M{"$sum": 1},
+				}},
+				{"$sort": bson.D{{Key: "outstanding", Value: -1}}},
+			},
+		}},
+	}
+
+	cursor, err := database.DebtCollection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		http.Error(w, "Error generating debt summary", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	var result []struct {
+		ByDirection []struct {
+			Direction   string  `bson:"_id"`
+			Principal   float64 `bson:"principal"`
+			Repaid      float64 `bson:"repaid"`
+			Outstanding float64 `bson:"outstanding"`
+			Count       int     `bson:"count"`
+			Overdue     int     `bson:"overdue"`
+		} `bson:"by_direction"`
+		ByCounterparty []struct {
+			ID struct {
+				Counterparty string `bson:"counterparty"`
+				Direction    string `bson:"direction"`
+			} `bson:"_id"`
+			Outstanding float64 `bson:"outstanding"`
+			Count       int     `bson:"count"`
+		} `bson:"by_counterparty"`
+	}
+	if err = cursor.All(context.Background(), &result); err != nil || len(result) == 0 {
+		http.Error(w, "Error decoding debt summary", http.StatusInternalServerError)
+		return
+	}
+
+	summary := map[string]interface{}{}
+	for _, direction := range []string{"payable", "receivable"} {
+		summary[direction] = map[string]interface{}{"principal": 0.0, "repaid": 0.0, "outstanding": 0.0, "count": 0, "overdue": 0}
+	}
+	for _, total := range result[0].ByDirection {
+		summary[total.Direction] = map[string]interface{}{
+			"principal":   total.Principal,
+			"repaid":      total.Repaid,
+			"outstanding": total.Outstanding,
+			"count":       total.Count,
+			"overdue":     total.Overdue,
+		}
+	}
+	counterparties := []map[string]interface{}{}
+	for _, total := range result[0].ByCounterparty {
+		counterparties = append(counterparties, map[string]interface{}{
+			"counterparty": total.ID.Counterparty,
+			"direction":    total.ID.Direction,
+			"outstanding":  total.Outstanding,
+			"count":        total.Count,
+		})
+	}
+	summary["by_counterparty"] = counterparties
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+func GetDebt(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	debtID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid debt ID", http.StatusBadRequest)
+		return
+	}
+
+	debt, err := findDebt(ledgerID, debtID)
+	if err != nil {
+		writeDebtError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(debt)
+}
+
+// UpdateDebt mengubah counterparty, pokok, keterangan, dan jatuh tempo. Arah dan
+// pembayaran tidak bisa diubah lewat endpoint ini.
+func UpdateDebt(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	debtID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid debt ID", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := findDebt(ledgerID, debtID)
+	if err != nil {
+		writeDebtError(w, err)
+		return
+	}
+
+	var debt models.Debt
+	if err := json.NewDecoder(r.Body).Decode(&debt); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	debt.Direction = existing.Direction
+	if err := validateDebt(&debt); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Pokok tidak boleh lebih kecil dari yang sudah dibayar; dicek di filter agar aman
+	// terhadap pembayaran yang masuk bersamaan
+	filter := bson.M{"_id": debtID, "user_id": ledgerID, "repaid": bson.M{"$lte": debt.Principal}}
+	update := bson.M{"$set": bson.M{
+		"counterparty": debt.Counterparty,
+		"principal":    debt.Principal,
+		"description":  debt.Description,
+		"due_date":     debt.DueDate,
+	}}
+	var updated models.Debt
+	err = database.DebtCollection.FindOneAndUpdate(context.Background(), filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, errPrincipalBelowRepaid.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Error updating debt", http.StatusInternalServerError)
+		return
+	}
+
+	if updated, err = refreshDebtSettlement(updated); err != nil {
+		http.Error(w, "Error updating debt", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteDebt menghapus hutang/piutang. Transaksi pembayarannya tetap ada, hanya
+// tautannya yang dilepas.
+func DeleteDebt(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	debtID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid debt ID", http.StatusBadRequest)
+		return
+	}
+
+	debt, err := findDebt(ledgerID, debtID)
+	if err != nil {
+		writeDebtError(w, err)
+		return
+	}
+
+	for _, repayment := range debt.Repayments {
+		if repayment.TransactionID != nil {
+			if err := unlinkTransactionDebt(actorID, ledgerID, *repayment.TransactionID, debtID); err != nil {
+				http.Error(w, "Error unlinking repayment transactions", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	if _, err := database.DebtCollection.DeleteOne(context.Background(), bson.M{"_id": debtID, "user_id": ledgerID}); err != nil {
+		http.Error(w, "Error deleting debt", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Debt deleted successfully"})
+}
+
+// AddDebtRepayment mencatat pembayaran sebagian atau pelunasan. Pembayaran bisa ditautkan
+// ke transaksi yang sudah ada (transaction_id) atau membuat transaksi baru jika
+// category_id diisi: pengeluaran untuk hutang, pemasukan untuk piutang.
+func AddDebtRepayment(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	debtID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid debt ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Amount        float64             `json:"amount"`
+		Date          time.Time           `json:"date"`
+		Note          string              `json:"note"`
+		TransactionID *primitive.ObjectID `json:"transaction_id"`
+		CategoryID    *primitive.ObjectID `json:"category_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.TransactionID != nil && request.CategoryID != nil {
+		http.Error(w, "Use either transaction_id or category_id, not both", http.StatusBadRequest)
+		return
+	}
+	if request.Date.IsZero() {
+		request.Date = time.Now()
+	}
+
+	debt, err := findDebt(ledgerID, debtID)
+	if err != nil {
+		writeDebtError(w, err)
+		return
+	}
+	if request.Amount <= 0 || cents(request.Amount) > cents(debt.Principal-debt.Repaid) {
+		http.Error(w, errInvalidRepayment.Error(), http.StatusBadRequest)
+		return
+	}
+
+	transactionType := "expense"
+	if debt.Direction == "receivable" {
+		transactionType = "income"
+	}
+
+	repayment := models.DebtRepayment{
+		ID:     primitive.NewObjectID(),
+		Amount: request.Amount,
+		Date:   request.Date,
+		Note:   strings.TrimSpace(request.Note),
+	}
+
+	// Transaksi yang sudah ada harus cocok dengan arah dan nominal pembayaran
+	if request.TransactionID != nil {
+		var transaction models.Transaction
+		err := database.TransactionCollection.FindOne(context.Background(),
+			bson.M{"_id": *request.TransactionID, "user_id": ledgerID, "deleted_at": nil}).Decode(&transaction)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, errRepaymentTransaction.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Error finding transaction", http.StatusInternalServerError)
+			return
+		}
+		if transaction.Type != transactionType || transaction.DebtID != nil || cents(transaction.Amount) != cents(request.Amount) {
+			http.Error(w, errRepaymentTransaction.Error(), http.StatusBadRequest)
+			return
+		}
+		repayment.TransactionID = request.TransactionID
+	}
+
+	// Tambahkan pembayaran hanya jika sisa hutang masih mencukupi saat ditulis
+	filter := bson.M{
+		"_id":     debtID,
+		"user_id": ledgerID,
+		"$expr":   bson.M{"$gte": bson.A{bson.M{"$subtract": bson.A{"$principal", "$repaid"}}, request.Amount - 0.005}},
+	}
+	update := bson.M{"$push": bson.M{"repayments": repayment}, "$inc": bson.M{"repaid": request.Amount}}
+	err = database.DebtCollection.FindOneAndUpdate(context.Background(), filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&debt)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, errInvalidRepayment.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Error recording repayment", http.StatusInternalServerError)
+		return
+	}
+
+	// Buat atau tautkan transaksi pembayaran
+	if request.CategoryID != nil {
+		description := "Pembayaran hutang ke " + debt.Counterparty
+		if debt.Direction == "receivable" {
+			description = "Pembayaran piutang dari " + debt.Counterparty
+		}
+		transaction := models.Transaction{
+			Type:        transactionType,
+			CategoryID:  *request.CategoryID,
+			Amount:      request.Amount,
+			Description: description,
+			Date:        request.Date,
+			DebtID:      &debtID,
+		}
+		if err := insertTransaction(actorID, ledgerID, &transaction); err != nil {
+			removeDebtRepayment(ledgerID, debtID, repayment)
+			if isValidationError(err) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				http.Error(w, "Error creating repayment transaction", http.StatusInternalServerError)
+			}
+			return
+		}
+		_, err = database.DebtCollection.UpdateOne(context.Background(),
+			bson.M{"_id": debtID, "repayments._id": repayment.ID},
+			bson.M{"$set": bson.M{"repayments.$.transaction_id": transaction.ID}})
+		if err != nil {
+			// Batalkan transaksi dan pembayaran agar tidak ada transaksi hutang tanpa pembayaran
+			if err := trashTransaction(actorID, ledgerID, transaction.ID); err != nil {
+				log.Printf("Error discarding repayment transaction %s: %v", transaction.ID.Hex(), err)
+			}
+			removeDebtRepayment(ledgerID, debtID, repayment)
+			http.Error(w, "Error linking repayment transaction", http.StatusInternalServerError)
+			return
+		}
+	} else if repayment.TransactionID != nil {
+		if err := linkTransactionDebt(actorID, ledgerID, *repayment.TransactionID, debtID); err != nil {
+			removeDebtRepayment(ledgerID, debtID, repayment)
+			if err == errDebtLinkChanged {
+				http.Error(w, err.Error(), http.StatusConflict)
+			} else {
+				http.Error(w, "Error linking repayment transaction", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
+	if debt, err = findDebt(ledgerID, debtID); err == nil {
+		debt, err = refreshDebtSettlement(debt)
+	}
+	if err != nil {
+		http.Error(w, "Error updating debt", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(debt)
+}
+
+// DeleteDebtRepayment membatalkan satu pembayaran. Transaksinya tidak dihapus, hanya
+// tautannya yang dilepas; hapus transaksinya secara terpisah jika perlu.
+func DeleteDebtRepayment(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	params := mux.Vars(r)
+	debtID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid debt ID", http.StatusBadRequest)
+		return
+	}
+	repaymentID, err := primitive.ObjectIDFromHex(params["repayment_id"])
+	if err != nil {
+		http.Error(w, "Invalid repayment ID", http.StatusBadRequest)
+		return
+	}
+
+	debt, err := findDebt(ledgerID, debtID)
+	if err != nil {
+		writeDebtError(w, err)
+		return
+	}
+
+	var repayment *models.DebtRepayment
+	for i := range debt.Repayments {
+		if debt.Repayments[i].ID == repaymentID {
+			repayment = &debt.Repayments[i]
+		}
+	}
+	if repayment == nil {
+		http.Error(w, "Repayment not found", http.StatusNotFound)
+		return
+	}
+
+	if err := removeDebtRepayment(ledgerID, debtID, *repayment); err != nil {
+		http.Error(w, "Error deleting repayment", http.StatusInternalServerError)
+		return
+	}
+	if repayment.TransactionID != nil {
+		if err := unlinkTransactionDebt(actorID, ledgerID, *repayment.TransactionID, debtID); err != nil {
+			http.Error(w, "Error unlinking repayment transaction", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if debt, err = findDebt(ledgerID, debtID); err == nil {
+		debt, err = refreshDebtSettlement(debt)
+	}
+	if err != nil {
+		http.Error(w, "Error updating debt", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(debt)
+}
+
+func validateDebt(debt *models.Debt) error {
+	debt.Counterparty = strings.TrimSpace(debt.Counterparty)
+	if debt.Counterparty == "" || debt.Principal <= 0 {
+		return errInvalidDebt
+	}
+	if debt.Direction != "payable" && debt.Direction != "receivable" {
+		return errInvalidDebt
+	}
+	return nil
+}
+
+func writeDebtError(w http.ResponseWriter, err error) {
+	if err == errDebtNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, "Error finding debt", http.StatusInternalServerError)
+}
+
+func findDebt(userID, debtID primitive.ObjectID) (models.Debt, error) {
+	var debt models.Debt
+	err := database.DebtCollection.FindOne(context.Background(), bson.M{"_id": debtID, "user_id": userID}).Decode(&debt)
+	if err == mongo.ErrNoDocuments {
+		return debt, errDebtNotFound
+	}
+	return debt, err
+}
+
+func removeDebtRepayment(userID, debtID primitive.ObjectID, repayment models.DebtRepayment) error {
+	_, err := database.DebtCollection.UpdateOne(context.Background(),
+		bson.M{"_id": debtID, "user_id": userID, "repayments._id": repayment.ID},
+		bson.M{"$pull": bson.M{"repayments": bson.M{"_id": repayment.ID}}, "$inc": bson.M{"repaid": -repayment.Amount}})
+	return err
+}
+
+// Fungsi helper untuk mengisi atau mengosongkan SettledAt sesuai sisa hutang
+func refreshDebtSettlement(debt models.Debt) (models.Debt, error) {
+	settled := cents(debt.Repaid) >= cents(debt.Principal)
+	if settled == (debt.SettledAt != nil) {
+		return debt, nil
+	}
+
+	update := bson.M{"$unset": bson.M{"settled_at": ""}}
+	debt.SettledAt = nil
+	if settled {
+		now := time.Now()
+		update = bson.M{"$set": bson.M{"settled_at": now}}
+		debt.SettledAt = &now
+	}
+	_, err := database.DebtCollection.UpdateOne(context.Background(), bson.M{"_id": debt.ID}, update)
+	return debt, err
+}
+
+// Fungsi helper untuk menautkan transaksi aktif yang belum tertaut ke hutang/piutang.
+// errDebtLinkChanged berarti transaksi sudah dihapus atau ditautkan oleh request lain
+// sejak dicek.
+func linkTransactionDebt(actorID, userID, transactionID, debtID primitive.ObjectID) error {
+	err := updateTransactionDebt(actorID, userID,
+		bson.M{"_id": transactionID, "user_id": userID, "deleted_at": nil, "debt_id": nil},
+		bson.M{"$set": bson.M{"debt_id": debtID}, "$inc": bson.M{"version": 1}}, &debtID)
+	if err == mongo.ErrNoDocuments {
+		return errDebtLinkChanged
+	}
+	return err
+}
+
+// Fungsi helper untuk melepas tautan transaksi dari hutang/piutang debtID. Transaksi yang
+// sudah dihapus permanen atau tidak lagi tertaut ke debtID dibiarkan.
+func unlinkTransactionDebt(actorID, userID, transactionID, debtID primitive.ObjectID) error {
+	err := updateTransactionDebt(actorID, userID,
+		bson.M{"_id": transactionID, "user_id": userID, "debt_id": debtID},
+		bson.M{"$unset": bson.M{"debt_id": ""}, "$inc": bson.M{"version": 1}}, nil)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	return err
+}
+
+// Fungsi helper untuk menulis tautan hutang transaksi dan mencatat perubahannya di audit log
+func updateTransactionDebt(actorID, userID primitive.ObjectID, filter, update bson.M, debtID *primitive.ObjectID) error {
+	releaseBalance, err := beginBalanceWrite(userID)
+	if err != nil {
+		return err
+	}
+	defer releaseBalance()
+
+	var before models.Transaction
+	if err := database.TransactionCollection.FindOneAndUpdate(context.Background(), filter, update).Decode(&before); err != nil {
+		return err
+	}
+
+	after := before
+	after.DebtID = debtID
+	after.Version++
+	recordTransactionChange(actorID, userID, "update", before.ID, &before, &after)
+	return nil
+}
+
+// Fungsi helper untuk memastikan penulisan tidak membuat hutang tidak sinkron dengan
+// transaksi pembayarannya: transaksi yang tertaut ke hutang tidak boleh dihapus (update
+// nil), dan tipe serta nominalnya tidak boleh diubah.
+func debtWriteAllowed(current models.Transaction, update *models.Transaction) bool {
+	return current.DebtID == nil || (update != nil && update.Type == current.Type && update.Amount == current.Amount)
+}
+
+// Fungsi helper untuk menambahkan syarat debtWriteAllowed ke filter update atau delete,
+// agar transaksi yang ditautkan di antara baca dan tulis tetap terlindungi
+func addDebtWriteCondition(filter bson.M, update *models.Transaction) {
+	if update == nil {
+		filter["debt_id"] = nil
+		return
+	}
+	filter["$or"] = bson.A{
+		bson.M{"debt_id": nil},
+		bson.M{"type": update.Type, "amount": update.Amount},
+	}
+}
+
+// Fungsi helper untuk membandingkan nominal dalam satuan sen
+func cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
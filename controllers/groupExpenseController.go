@@ -0,0 +1,1058 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"finance-app/database"
+	"finance-app/models"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Nama kategori yang dibuat otomatis di ledger pribadi anggota untuk transaksi patungan
+const groupExpenseCategoryName = "Patungan"
+
+var (
+	errSharedLedgerRequired  = errors.New("Group expenses need a shared ledger. Send the X-Ledger-ID header")
+	errGroupExpenseNotFound  = errors.New("Group expense not found")
+	errInvalidGroupExpense   = errors.New("Group expense needs a positive amount and a method of 'equal', 'shares' or 'exact'")
+	errInvalidGroupShares    = errors.New("Shares must list distinct ledger members with positive weights (shares) or amounts that add up to the total (exact)")
+	errGroupMemberNotFound   = errors.New("User is not an active member of this ledger")
+	errGroupExpensePayer     = errors.New("You can only record group expenses you paid yourself")
+	errGroupExpenseForbidden = errors.New("Only the payer can delete this group expense")
+	errInvalidSettlement     = errors.New("Settlement amount must be positive and not exceed what the sender owes and the receiver is owed")
+	errSettlementParty       = errors.New("You can only record settlements you send")
+	errGroupEntryNotFound    = errors.New("Pending group entry not found")
+	errInvalidEntryStatus    = errors.New("Invalid status. Must be 'pending', 'confirmed', 'rejected' or 'cancelled'")
+)
+
+// groupBalance adalah posisi satu anggota: Net positif berarti anggota masih harus
+// menerima uang, negatif berarti masih berhutang
+type groupBalance struct {
+	UserID   primitive.ObjectID `json:"user_id"`
+	Username string             `json:"username"`
+	Paid     float64            `json:"paid"`
+	Owed     float64            `json:"owed"`
+	Net      float64            `json:"net"`
+}
+
+// groupTransfer adalah satu pembayaran yang disarankan untuk melunasi patungan
+type groupTransfer struct {
+	FromUserID   primitive.ObjectID `json:"from_user_id"`
+	FromUsername string             `json:"from_username"`
+	ToUserID     primitive.ObjectID `json:"to_user_id"`
+	ToUsername   string             `json:"to_username"`
+	Amount       float64            `json:"amount"`
+}
+
+// CreateGroupExpense mencatat pengeluaran yang dibayar user sendiri di ledger bersama dan
+// dibagi rata (equal), berdasarkan bobot (shares), atau nominal pasti (exact). Bagian
+// pembayar langsung dicatat di ledger pribadinya; bagian anggota lain dikirim sebagai
+// entri yang menunggu konfirmasi, karena tidak ada yang boleh menulis ke ledger pribadi
+// anggota lain.
+func CreateGroupExpense(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dan user ID dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	ledger, err := findGroupLedger(actorID, ledgerID)
+	if err != nil {
+		writeGroupExpenseError(w, err)
+		return
+	}
+
+	var request struct {
+		PaidBy      primitive.ObjectID         `json:"paid_by"`
+		Description string                     `json:"description"`
+		Amount      float64                    `json:"amount"`
+		Date        time.Time                  `json:"date"`
+		Method      string                     `json:"method"`
+		CategoryID  primitive.ObjectID         `json:"category_id"` // Kategori bagian pembayar di ledger pribadinya (opsional)
+		Shares      []models.GroupExpenseShare `json:"shares"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.PaidBy.IsZero() {
+		request.PaidBy = actorID
+	}
+	if request.PaidBy != actorID {
+		writeGroupExpenseError(w, errGroupExpensePayer)
+		return
+	}
+	if request.Date.IsZero() {
+		request.Date = time.Now()
+	}
+	if request.Method == "" {
+		request.Method = "equal"
+	}
+
+	// Tanpa daftar anggota, pembagian rata mencakup semua anggota aktif
+	if request.Method == "equal" && len(request.Shares) == 0 {
+		for _, member := range ledger.Members {
+			if member.Status == "active" {
+				request.Shares = append(request.Shares, models.GroupExpenseShare{UserID: member.UserID})
+			}
+		}
+	}
+
+	expense := models.GroupExpense{
+		ID:          primitive.NewObjectID(),
+		UserID:      ledgerID,
+		PaidBy:      actorID,
+		Description: strings.TrimSpace(request.Description),
+		Amount:      request.Amount,
+		Date:        request.Date,
+		Method:      request.Method,
+		Shares:      request.Shares,
+		CreatedBy:   actorID,
+		CreatedAt:   time.Now(),
+	}
+	if err := computeGroupShares(ledger, &expense); err != nil {
+		writeGroupExpenseError(w, err)
+		return
+	}
+
+	// Pembayar yang tidak ikut menanggung biaya tidak mendapat transaksi
+	var payerShare float64
+	for _, share := range expense.Shares {
+		if share.UserID == actorID {
+			payerShare = share.Amount
+		}
+	}
+	categoryID := request.CategoryID
+	if payerShare > 0 {
+		if categoryID.IsZero() {
+			if categoryID, err = groupExpenseCategory(actorID, "expense"); err != nil {
+				http.Error(w, "Error preparing group expense category", http.StatusInternalServerError)
+				return
+			}
+		}
+		transactionID := primitive.NewObjectID()
+		expense.TransactionID = &transactionID
+	}
+
+	if _, err := loadGroupPositions(ledger); err != nil {
+		http.Error(w, "Error preparing group balances", http.StatusInternalServerError)
+		return
+	}
+
+	// Dokumen, posisi, dan entri anggota disimpan lebih dulu dengan ID transaksi yang sudah
+	// disiapkan, lalu dibatalkan lagi jika transaksi pembayar gagal dibuat
+	if _, err := database.GroupExpenseCollection.InsertOne(context.Background(), expense); err != nil {
+		http.Error(w, "Error creating group expense", http.StatusInternalServerError)
+		return
+	}
+	if err := applyGroupExpensePositions(ledger, expense, 1); err != nil {
+		database.GroupExpenseCollection.DeleteOne(context.Background(), bson.M{"_id": expense.ID})
+		http.Error(w, "Error updating group balances", http.StatusInternalServerError)
+		return
+	}
+	if err := createGroupEntries(ledger, expense); err != nil {
+		removeGroupExpense(ledger, expense)
+		http.Error(w, "Error creating group expense entries", http.StatusInternalServerError)
+		return
+	}
+
+	if expense.TransactionID != nil {
+		transaction := models.Transaction{
+			ID:          *expense.TransactionID,
+			Type:        "expense",
+			CategoryID:  categoryID,
+			Amount:      payerShare,
+			Description: groupExpenseDescription(ledger, expense.Description),
+			Date:        expense.Date,
+		}
+		if err := insertTransaction(actorID, actorID, &transaction); err != nil {
+			removeGroupExpense(ledger, expense)
+			if isValidationError(err) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				http.Error(w, "Error creating group expense transaction", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(expense)
+}
+
+func GetGroupExpenses(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dan user ID dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	if _, err := findGroupLedger(actorID, ledgerID); err != nil {
+		writeGroupExpenseError(w, err)
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := database.GroupExpenseCollection.Find(context.Background(), bson.M{"user_id": ledgerID, "deleted_at": nil}, opts)
+	if err != nil {
+		http.Error(w, "Error fetching group expenses", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	expenses := []models.GroupExpense{}
+	if err = cursor.All(context.Background(), &expenses); err != nil {
+		http.Error(w, "Error decoding group expenses", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(expenses)
+}
+
+// DeleteGroupExpense menghapus pengeluaran patungan, memindahkan transaksi pembayar ke
+// tempat sampah, dan membatalkan entri anggota yang belum dikonfirmasi. Entri yang sudah
+// dikonfirmasi dan pelunasan yang sudah tercatat tidak diubah.
+func DeleteGroupExpense(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dan user ID dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	expenseID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid group expense ID", http.StatusBadRequest)
+		return
+	}
+
+	ledger, err := findGroupLedger(actorID, ledgerID)
+	if err != nil {
+		writeGroupExpenseError(w, err)
+		return
+	}
+
+	var expense models.GroupExpense
+	err = database.GroupExpenseCollection.FindOne(context.Background(), bson.M{"_id": expenseID, "user_id": ledgerID, "deleted_at": nil}).Decode(&expense)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeGroupExpenseError(w, errGroupExpenseNotFound)
+		} else {
+			http.Error(w, "Error fetching group expense", http.StatusInternalServerError)
+		}
+		return
+	}
+	// Transaksi pembayar ada di ledger pribadinya, jadi hanya pembayar yang boleh menghapus
+	if actorID != expense.PaidBy {
+		writeGroupExpenseError(w, errGroupExpenseForbidden)
+		return
+	}
+	if _, err := loadGroupPositions(ledger); err != nil {
+		http.Error(w, "Error preparing group balances", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	result, err := database.GroupExpenseCollection.UpdateOne(context.Background(),
+		bson.M{"_id": expenseID, "deleted_at": nil},
+		bson.M{"$set": bson.M{"deleted_at": now}})
+	if err != nil {
+		http.Error(w, "Error deleting group expense", http.StatusInternalServerError)
+		return
+	}
+	if result.ModifiedCount == 0 {
+		writeGroupExpenseError(w, errGroupExpenseNotFound)
+		return
+	}
+	if err := applyGroupExpensePositions(ledger, expense, -1); err != nil {
+		database.GroupExpenseCollection.UpdateOne(context.Background(), bson.M{"_id": expenseID}, bson.M{"$unset": bson.M{"deleted_at": ""}})
+		http.Error(w, "Error updating group balances", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = database.GroupEntryCollection.UpdateMany(context.Background(),
+		bson.M{"group_expense_id": expenseID, "status": "pending"},
+		bson.M{"$set": bson.M{"status": "cancelled", "resolved_at": now}})
+	if err != nil {
+		http.Error(w, "Error cancelling group expense entries", http.StatusInternalServerError)
+		return
+	}
+
+	if expense.TransactionID != nil {
+		releaseBalance, err := beginBalanceWrite(expense.PaidBy)
+		if err != nil {
+			http.Error(w, "Error preparing balance snapshot", http.StatusInternalServerError)
+			return
+		}
+		defer releaseBalance()
+
+		var deleted models.Transaction
+		err = database.TransactionCollection.FindOneAndUpdate(context.Background(),
+			bson.M{"_id": *expense.TransactionID, "user_id": expense.PaidBy, "deleted_at": nil},
+			bson.M{"$set": bson.M{"deleted_at": now}, "$inc": bson.M{"version": 1}}).Decode(&deleted)
+		if err == nil {
+			recordTransactionChange(actorID, expense.PaidBy, "delete", deleted.ID, &deleted, nil)
+		} else if err != mongo.ErrNoDocuments {
+			http.Error(w, "Error deleting group expense transaction", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Group expense deleted successfully"})
+}
+
+// GetGroupEntries mengembalikan bagian patungan milik user dari semua ledger bersama,
+// default yang masih menunggu konfirmasi (?status=). Entri berlaku untuk ledger pribadi,
+// sehingga header X-Ledger-ID tidak diperlukan.
+func GetGroupEntries(w http.ResponseWriter, r *http.Request) {
+	// Ambil user ID dari context
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = "pending"
+	case "pending", "confirmed", "rejected", "cancelled":
+	default:
+		http.Error(w, errInvalidEntryStatus.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := database.GroupEntryCollection.Find(context.Background(), bson.M{"user_id": actorID, "status": status}, opts)
+	if err != nil {
+		http.Error(w, "Error fetching group entries", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	entries := []models.GroupEntry{}
+	if err = cursor.All(context.Background(), &entries); err != nil {
+		http.Error(w, "Error decoding group entries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// ConfirmGroupEntry mencatat entri user di ledger pribadinya sesuai tipenya: bagian
+// patungan sebagai pengeluaran dan pelunasan yang diterima sebagai pemasukan, dengan
+// category_id opsional (default kategori Patungan bertipe sama)
+func ConfirmGroupEntry(w http.ResponseWriter, r *http.Request) {
+	// Ambil user ID dari context
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	entryID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid group entry ID", http.StatusBadRequest)
+		return
+	}
+
+	// Body boleh kosong
+	var request struct {
+		CategoryID primitive.ObjectID `json:"category_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var entry models.GroupEntry
+	err = database.GroupEntryCollection.FindOne(context.Background(), bson.M{"_id": entryID, "user_id": actorID, "status": "pending"}).Decode(&entry)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeGroupExpenseError(w, errGroupEntryNotFound)
+		} else {
+			http.Error(w, "Error fetching group entry", http.StatusInternalServerError)
+		}
+		return
+	}
+	entryType := groupEntryType(entry)
+	categoryID := request.CategoryID
+	if categoryID.IsZero() {
+		if categoryID, err = groupExpenseCategory(actorID, entryType); err != nil {
+			http.Error(w, "Error preparing group expense category", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Status diubah secara atomik agar entri tidak dikonfirmasi dua kali atau dikonfirmasi
+	// setelah patungannya dihapus
+	transactionID := primitive.NewObjectID()
+	err = database.GroupEntryCollection.FindOneAndUpdate(context.Background(),
+		bson.M{"_id": entryID, "user_id": actorID, "status": "pending"},
+		bson.M{"$set": bson.M{"status": "confirmed", "transaction_id": transactionID, "resolved_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&entry)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeGroupExpenseError(w, errGroupEntryNotFound)
+		} else {
+			http.Error(w, "Error confirming group entry", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	transaction := models.Transaction{
+		ID:          transactionID,
+		Type:        entryType,
+		CategoryID:  categoryID,
+		Amount:      entry.Amount,
+		Description: entry.Description,
+		Date:        entry.Date,
+	}
+	if err := insertTransaction(actorID, actorID, &transaction); err != nil {
+		// Kembalikan entri ke pending agar bisa dikonfirmasi ulang
+		database.GroupEntryCollection.UpdateOne(context.Background(), bson.M{"_id": entryID},
+			bson.M{"$set": bson.M{"status": "pending"}, "$unset": bson.M{"transaction_id": "", "resolved_at": ""}})
+		if isValidationError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "Error creating group entry transaction", http.StatusInternalServerError)
+		}
+		return
+	}
+	if entry.GroupSettlementID != nil {
+		_, err := database.GroupSettlementCollection.UpdateOne(context.Background(),
+			bson.M{"_id": *entry.GroupSettlementID}, bson.M{"$set": bson.M{"to_transaction_id": transactionID}})
+		if err != nil {
+			log.Printf("group settlement %s: linking transaction %s: %v", entry.GroupSettlementID.Hex(), transactionID.Hex(), err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// RejectGroupEntry menolak mencatat bagian patungan di ledger pribadi user. Posisi
+// patungan tidak berubah; hapus atau ubah patungannya jika pembagiannya salah.
+func RejectGroupEntry(w http.ResponseWriter, r *http.Request) {
+	// Ambil user ID dari context
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	entryID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid group entry ID", http.StatusBadRequest)
+		return
+	}
+
+	var entry models.GroupEntry
+	err = database.GroupEntryCollection.FindOneAndUpdate(context.Background(),
+		bson.M{"_id": entryID, "user_id": actorID, "status": "pending"},
+		bson.M{"$set": bson.M{"status": "rejected", "resolved_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&entry)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeGroupExpenseError(w, errGroupEntryNotFound)
+		} else {
+			http.Error(w, "Error rejecting group entry", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// GetGroupBalances menghitung siapa berhutang kepada siapa di ledger bersama, beserta
+// daftar transfer pelunasan dengan jumlah transfer sesedikit mungkin
+func GetGroupBalances(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dan user ID dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	ledger, err := findGroupLedger(actorID, ledgerID)
+	if err != nil {
+		writeGroupExpenseError(w, err)
+		return
+	}
+
+	balances, err := groupBalances(ledger)
+	if err != nil {
+		http.Error(w, "Error calculating group balances", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"balances":  balances,
+		"transfers": settlementTransfers(balances),
+	})
+}
+
+// CreateGroupSettlement mencatat pembayaran pelunasan dari user ke anggota lain dan
+// memindahkan posisi kedua anggota. Seperti patungan, pengirim langsung mencatat
+// pengeluaran di ledger pribadinya (category_id opsional), sedangkan penerima mendapat
+// entri pemasukan yang menunggu konfirmasinya.
+func CreateGroupSettlement(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dan user ID dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	ledger, err := findGroupLedger(actorID, ledgerID)
+	if err != nil {
+		writeGroupExpenseError(w, err)
+		return
+	}
+
+	var request struct {
+		FromUserID primitive.ObjectID `json:"from_user_id"`
+		ToUserID   primitive.ObjectID `json:"to_user_id"`
+		Amount     float64            `json:"amount"`
+		Date       time.Time          `json:"date"`
+		CategoryID primitive.ObjectID `json:"category_id"` // Kategori pengeluaran pengirim di ledger pribadinya (opsional)
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	settlement := models.GroupSettlement{
+		FromUserID: request.FromUserID,
+		ToUserID:   request.ToUserID,
+		Amount:     request.Amount,
+		Date:       request.Date,
+	}
+	if settlement.FromUserID.IsZero() {
+		settlement.FromUserID = actorID
+	}
+	if settlement.Date.IsZero() {
+		settlement.Date = time.Now()
+	}
+	if actorID != settlement.FromUserID {
+		writeGroupExpenseError(w, errSettlementParty)
+		return
+	}
+	from, fromOK := activeLedgerMember(ledger, settlement.FromUserID)
+	to, toOK := activeLedgerMember(ledger, settlement.ToUserID)
+	if !fromOK || !toOK || from.UserID == to.UserID {
+		writeGroupExpenseError(w, errGroupMemberNotFound)
+		return
+	}
+	amount := cents(settlement.Amount)
+	if amount <= 0 {
+		writeGroupExpenseError(w, errInvalidSettlement)
+		return
+	}
+
+	categoryID := request.CategoryID
+	if categoryID.IsZero() {
+		if categoryID, err = groupExpenseCategory(actorID, "expense"); err != nil {
+			http.Error(w, "Error preparing group expense category", http.StatusInternalServerError)
+			return
+		}
+	}
+	if _, err := loadGroupPositions(ledger); err != nil {
+		http.Error(w, "Error preparing group balances", http.StatusInternalServerError)
+		return
+	}
+
+	// Pelunasan tidak boleh melebihi hutang pengirim maupun piutang penerima. Batasnya dicek
+	// di filter update agar dua pelunasan bersamaan tidak bisa sama-sama lolos.
+	fromNet := "members." + from.UserID.Hex() + ".net"
+	toNet := "members." + to.UserID.Hex() + ".net"
+	result, err := database.GroupPositionCollection.UpdateOne(context.Background(),
+		bson.M{"_id": ledger.ID, fromNet: bson.M{"$lte": -amount}, toNet: bson.M{"$gte": amount}},
+		bson.M{"$inc": bson.M{fromNet: amount, toNet: -amount}})
+	if err != nil {
+		http.Error(w, "Error updating group balances", http.StatusInternalServerError)
+		return
+	}
+	if result.MatchedCount == 0 {
+		writeGroupExpenseError(w, errInvalidSettlement)
+		return
+	}
+
+	// Pelunasan dan entri penerima disimpan dengan ID transaksi pengirim yang sudah
+	// disiapkan, lalu dibatalkan bersama posisinya jika salah satu penulisan gagal
+	transactionID := primitive.NewObjectID()
+	settlement.ID = primitive.NewObjectID()
+	settlement.UserID = ledgerID
+	settlement.Amount = float64(amount) / 100
+	settlement.FromTransactionID, settlement.ToTransactionID = &transactionID, nil
+	settlement.CreatedBy = actorID
+	settlement.CreatedAt = time.Now()
+	if _, err := database.GroupSettlementCollection.InsertOne(context.Background(), settlement); err != nil {
+		removeGroupSettlement(ledger, settlement)
+		http.Error(w, "Error recording settlement", http.StatusInternalServerError)
+		return
+	}
+	entry := models.GroupEntry{
+		ID:                primitive.NewObjectID(),
+		UserID:            to.UserID,
+		LedgerID:          ledger.ID,
+		GroupSettlementID: &settlement.ID,
+		Type:              "income",
+		Amount:            settlement.Amount,
+		Description:       groupExpenseDescription(ledger, "pelunasan dari "+from.Username),
+		Date:              settlement.Date,
+		Status:            "pending",
+		CreatedBy:         actorID,
+		CreatedAt:         settlement.CreatedAt,
+	}
+	if _, err := database.GroupEntryCollection.InsertOne(context.Background(), entry); err != nil {
+		removeGroupSettlement(ledger, settlement)
+		http.Error(w, "Error creating settlement entry", http.StatusInternalServerError)
+		return
+	}
+
+	transaction := models.Transaction{
+		ID:          transactionID,
+		Type:        "expense",
+		CategoryID:  categoryID,
+		Amount:      settlement.Amount,
+		Description: groupExpenseDescription(ledger, "pelunasan ke "+to.Username),
+		Date:        settlement.Date,
+	}
+	if err := insertTransaction(actorID, actorID, &transaction); err != nil {
+		removeGroupSettlement(ledger, settlement)
+		if isValidationError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "Error creating settlement transaction", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(settlement)
+}
+
+func GetGroupSettlements(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dan user ID dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	if _, err := findGroupLedger(actorID, ledgerID); err != nil {
+		writeGroupExpenseError(w, err)
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := database.GroupSettlementCollection.Find(context.Background(), bson.M{"user_id": ledgerID}, opts)
+	if err != nil {
+		http.Error(w, "Error fetching settlements", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	settlements := []models.GroupSettlement{}
+	if err = cursor.All(context.Background(), &settlements); err != nil {
+		http.Error(w, "Error decoding settlements", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settlements)
+}
+
+func writeGroupExpenseError(w http.ResponseWriter, err error) {
+	switch err {
+	case errSharedLedgerRequired, errInvalidGroupExpense, errInvalidGroupShares, errGroupMemberNotFound, errInvalidSettlement:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errLedgerNotFound, errGroupExpenseNotFound, errGroupEntryNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errGroupExpensePayer, errGroupExpenseForbidden, errSettlementParty:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, "Error processing group expense", http.StatusInternalServerError)
+	}
+}
+
+// Fungsi helper untuk ledger bersama aktif; patungan tidak berlaku di ledger pribadi
+func findGroupLedger(userID, ledgerID primitive.ObjectID) (models.Ledger, error) {
+	if ledgerID == userID {
+		return models.Ledger{}, errSharedLedgerRequired
+	}
+	ledger, _, err := findLedgerForMember(userID, ledgerID, false)
+	return ledger, err
+}
+
+func activeLedgerMember(ledger models.Ledger, userID primitive.ObjectID) (models.LedgerMember, bool) {
+	member, ok := ledgerMember(ledger, userID)
+	return member, ok && member.Status == "active"
+}
+
+// Fungsi helper untuk mengisi Amount setiap bagian sesuai metode pembagian. Perhitungan
+// dilakukan dalam satuan sen dan sisa pembulatan dibagikan satu sen per anggota.
+func computeGroupShares(ledger models.Ledger, expense *models.GroupExpense) error {
+	total := cents(expense.Amount)
+	if total <= 0 {
+		return errInvalidGroupExpense
+	}
+	if len(expense.Shares) == 0 {
+		return errInvalidGroupShares
+	}
+
+	seen := make(map[primitive.ObjectID]bool, len(expense.Shares))
+	weights := make([]float64, len(expense.Shares))
+	var exactTotal int64
+	for i := range expense.Shares {
+		share := &expense.Shares[i]
+		member, ok := activeLedgerMember(ledger, share.UserID)
+		if !ok {
+			return errGroupMemberNotFound
+		}
+		if seen[share.UserID] {
+			return errInvalidGroupShares
+		}
+		seen[share.UserID] = true
+		share.Username = member.Username
+
+		switch expense.Method {
+		case "equal":
+			share.Weight = 0
+			weights[i] = 1
+		case "shares":
+			if share.Weight <= 0 {
+				return errInvalidGroupShares
+			}
+			weights[i] = share.Weight
+		case "exact":
+			share.Weight = 0
+			if share.Amount < 0 {
+				return errInvalidGroupShares
+			}
+			exactTotal += cents(share.Amount)
+		default:
+			return errInvalidGroupExpense
+		}
+	}
+
+	if expense.Method == "exact" {
+		if exactTotal != total {
+			return errInvalidGroupShares
+		}
+		for i := range expense.Shares {
+			expense.Shares[i].Amount = float64(cents(expense.Shares[i].Amount)) / 100
+		}
+		return nil
+	}
+
+	for i, amount := range allocateCents(total, weights) {
+		expense.Shares[i].Amount = float64(amount) / 100
+	}
+	return nil
+}
+
+// Fungsi helper untuk membagi total (sen) sesuai bobot. Sisa pembulatan diberikan ke
+// bagian dengan pecahan terbesar sehingga jumlahnya selalu sama dengan total.
+func allocateCents(total int64, weights []float64) []int64 {
+	var weightSum float64
+	for _, weight := range weights {
+		weightSum += weight
+	}
+
+	amounts := make([]int64, len(weights))
+	fractions := make([]float64, len(weights))
+	var allocated int64
+	for i, weight := range weights {
+		exact := float64(total) * weight / weightSum
+		amounts[i] = int64(math.Floor(exact))
+		fractions[i] = exact - float64(amounts[i])
+		allocated += amounts[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return fractions[order[a]] > fractions[order[b]] })
+	for i := 0; allocated < total; i++ {
+		amounts[order[i%len(order)]]++
+		allocated++
+	}
+	return amounts
+}
+
+// Fungsi helper untuk posisi setiap anggota ledger beserta daftar anggota aktif yang
+// belum memiliki posisi
+func groupBalances(ledger models.Ledger) ([]groupBalance, error) {
+	position, err := loadGroupPositions(ledger)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range ledger.Members {
+		if _, ok := position.Members[member.UserID.Hex()]; !ok && member.Status == "active" {
+			position.Members[member.UserID.Hex()] = models.GroupMemberPosition{Username: member.Username}
+		}
+	}
+
+	balances := make([]groupBalance, 0, len(position.Members))
+	for hex, member := range position.Members {
+		userID, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			continue
+		}
+		// Nama terbaru diambil dari ledger; anggota yang sudah keluar memakai nama tersimpan
+		if current, ok := ledgerMember(ledger, userID); ok {
+			member.Username = current.Username
+		}
+		balances = append(balances, groupBalance{
+			UserID:   userID,
+			Username: member.Username,
+			Paid:     float64(member.Paid) / 100,
+			Owed:     float64(member.Owed) / 100,
+			Net:      float64(member.Net) / 100,
+		})
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].Net != balances[j].Net {
+			return balances[i].Net > balances[j].Net
+		}
+		return balances[i].UserID.Hex() < balances[j].UserID.Hex()
+	})
+	return balances, nil
+}
+
+// Fungsi helper untuk dokumen posisi ledger. Ledger yang patungannya dicatat sebelum posisi
+// disimpan dihitung ulang dari patungan dan pelunasannya. Setiap penulisan patungan dan
+// pelunasan memanggil fungsi ini lebih dulu, sehingga dokumen hasil hitung ulang hanya
+// tersimpan jika belum ada penulisan baru yang bisa terlewat.
+func loadGroupPositions(ledger models.Ledger) (models.GroupPosition, error) {
+	var position models.GroupPosition
+	err := database.GroupPositionCollection.FindOne(context.Background(), bson.M{"_id": ledger.ID}).Decode(&position)
+	if err == nil && position.Members == nil {
+		position.Members = make(map[string]models.GroupMemberPosition)
+	}
+	if err != mongo.ErrNoDocuments {
+		return position, err
+	}
+
+	position, err = computeGroupPositions(ledger)
+	if err != nil {
+		return position, err
+	}
+	_, err = database.GroupPositionCollection.InsertOne(context.Background(), position)
+	if mongo.IsDuplicateKeyError(err) {
+		// Request lain sudah menyimpannya lebih dulu
+		return loadGroupPositions(ledger)
+	}
+	return position, err
+}
+
+// Fungsi helper untuk menghitung posisi dari patungan dan pelunasan yang tersimpan: yang
+// dibayarkan dikurangi bagiannya, disesuaikan dengan pelunasan
+func computeGroupPositions(ledger models.Ledger) (models.GroupPosition, error) {
+	position := models.GroupPosition{ID: ledger.ID, Members: make(map[string]models.GroupMemberPosition)}
+	add := func(userID primitive.ObjectID, username string, paid, owed, net int64) {
+		member := position.Members[userID.Hex()]
+		if member.Username == "" {
+			member.Username = username
+		}
+		member.Paid += paid
+		member.Owed += owed
+		member.Net += net
+		position.Members[userID.Hex()] = member
+	}
+
+	cursor, err := database.GroupExpenseCollection.Find(context.Background(), bson.M{"user_id": ledger.ID, "deleted_at": nil})
+	if err != nil {
+		return position, err
+	}
+	var expenses []models.GroupExpense
+	if err = cursor.All(context.Background(), &expenses); err != nil {
+		return position, err
+	}
+	for _, expense := range expenses {
+		payer, _ := ledgerMember(ledger, expense.PaidBy)
+		add(expense.PaidBy, payer.Username, cents(expense.Amount), 0, cents(expense.Amount))
+		for _, share := range expense.Shares {
+			add(share.UserID, share.Username, 0, cents(share.Amount), -cents(share.Amount))
+		}
+	}
+
+	cursor, err = database.GroupSettlementCollection.Find(context.Background(), bson.M{"user_id": ledger.ID})
+	if err != nil {
+		return position, err
+	}
+	var settlements []models.GroupSettlement
+	if err = cursor.All(context.Background(), &settlements); err != nil {
+		return position, err
+	}
+	for _, settlement := range settlements {
+		from, _ := ledgerMember(ledger, settlement.FromUserID)
+		to, _ := ledgerMember(ledger, settlement.ToUserID)
+		add(settlement.FromUserID, from.Username, 0, 0, cents(settlement.Amount))
+		add(settlement.ToUserID, to.Username, 0, 0, -cents(settlement.Amount))
+	}
+	return position, nil
+}
+
+// Fungsi helper untuk menambah (sign 1) atau mengurangi (sign -1) satu patungan dari
+// posisi anggota dalam satu $inc
+func applyGroupExpensePositions(ledger models.Ledger, expense models.GroupExpense, sign int64) error {
+	inc := bson.M{}
+	set := bson.M{}
+	net := make(map[primitive.ObjectID]int64)
+
+	payer := "members." + expense.PaidBy.Hex() + "."
+	inc[payer+"paid"] = sign * cents(expense.Amount)
+	net[expense.PaidBy] += sign * cents(expense.Amount)
+	if member, ok := ledgerMember(ledger, expense.PaidBy); ok {
+		set[payer+"username"] = member.Username
+	}
+	for _, share := range expense.Shares {
+		key := "members." + share.UserID.Hex() + "."
+		inc[key+"owed"] = sign * cents(share.Amount)
+		net[share.UserID] -= sign * cents(share.Amount)
+		set[key+"username"] = share.Username
+	}
+	for userID, amount := range net {
+		inc["members."+userID.Hex()+".net"] = amount
+	}
+
+	update := bson.M{"$inc": inc}
+	if sign > 0 {
+		update["$set"] = set
+	}
+	_, err := database.GroupPositionCollection.UpdateOne(context.Background(), bson.M{"_id": ledger.ID}, update)
+	return err
+}
+
+// Fungsi helper untuk mengirim bagian anggota selain pembayar sebagai entri yang menunggu
+// konfirmasi
+func createGroupEntries(ledger models.Ledger, expense models.GroupExpense) error {
+	var entries []interface{}
+	for _, share := range expense.Shares {
+		if share.UserID == expense.PaidBy || cents(share.Amount) == 0 {
+			continue
+		}
+		entries = append(entries, models.GroupEntry{
+			ID:             primitive.NewObjectID(),
+			UserID:         share.UserID,
+			LedgerID:       ledger.ID,
+			GroupExpenseID: expense.ID,
+			Type:           "expense",
+			Amount:         share.Amount,
+			Description:    groupExpenseDescription(ledger, expense.Description),
+			Date:           expense.Date,
+			Status:         "pending",
+			CreatedBy:      expense.CreatedBy,
+			CreatedAt:      expense.CreatedAt,
+		})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	_, err := database.GroupEntryCollection.InsertMany(context.Background(), entries)
+	return err
+}
+
+// Fungsi helper untuk membatalkan patungan yang gagal dibuat sepenuhnya
+func removeGroupExpense(ledger models.Ledger, expense models.GroupExpense) {
+	database.GroupEntryCollection.DeleteMany(context.Background(), bson.M{"group_expense_id": expense.ID})
+	applyGroupExpensePositions(ledger, expense, -1)
+	database.GroupExpenseCollection.DeleteOne(context.Background(), bson.M{"_id": expense.ID})
+}
+
+// Fungsi helper untuk membatalkan pelunasan yang gagal dibuat sepenuhnya, termasuk
+// perpindahan posisinya
+func removeGroupSettlement(ledger models.Ledger, settlement models.GroupSettlement) {
+	amount := cents(settlement.Amount)
+	database.GroupEntryCollection.DeleteMany(context.Background(), bson.M{"group_settlement_id": settlement.ID})
+	database.GroupPositionCollection.UpdateOne(context.Background(), bson.M{"_id": ledger.ID},
+		bson.M{"$inc": bson.M{
+			"members." + settlement.FromUserID.Hex() + ".net": -amount,
+			"members." + settlement.ToUserID.Hex() + ".net":   amount,
+		}})
+	database.GroupSettlementCollection.DeleteOne(context.Background(), bson.M{"_id": settlement.ID})
+}
+
+// Fungsi helper untuk tipe transaksi entri; entri lama tanpa tipe adalah bagian patungan
+func groupEntryType(entry models.GroupEntry) string {
+	if entry.Type == "" {
+		return "expense"
+	}
+	return entry.Type
+}
+
+// Fungsi helper untuk daftar transfer pelunasan. Anggota yang paling banyak berhutang
+// membayar anggota yang paling banyak berpiutang sampai salah satunya lunas, sehingga
+// setiap transfer melunasi minimal satu anggota dan jumlah transfer paling banyak n-1.
+func settlementTransfers(balances []groupBalance) []groupTransfer {
+	type position struct {
+		balance groupBalance
+		amount  int64
+	}
+	var creditors, debtors []position
+	for _, balance := range balances {
+		if amount := cents(balance.Net); amount > 0 {
+			creditors = append(creditors, position{balance, amount})
+		} else if amount < 0 {
+			debtors = append(debtors, position{balance, -amount})
+		}
+	}
+
+	transfers := []groupTransfer{}
+	for len(creditors) > 0 && len(debtors) > 0 {
+		sort.SliceStable(creditors, func(i, j int) bool { return creditors[i].amount > creditors[j].amount })
+		sort.SliceStable(debtors, func(i, j int) bool { return debtors[i].amount > debtors[j].amount })
+
+		creditor, debtor := &creditors[0], &debtors[0]
+		amount := creditor.amount
+		if debtor.amount < amount {
+			amount = debtor.amount
+		}
+		transfers = append(transfers, groupTransfer{
+			FromUserID:   debtor.balance.UserID,
+			FromUsername: debtor.balance.Username,
+			ToUserID:     creditor.balance.UserID,
+			ToUsername:   creditor.balance.Username,
+			Amount:       float64(amount) / 100,
+		})
+		creditor.amount -= amount
+		debtor.amount -= amount
+		if creditor.amount == 0 {
+			creditors = creditors[1:]
+		}
+		if debtor.amount == 0 {
+			debtors = debtors[1:]
+		}
+	}
+	return transfers
+}
+
+// Fungsi helper untuk kategori "Patungan" di ledger pribadi user, dibuat jika belum ada
+func groupExpenseCategory(userID primitive.ObjectID, categoryType string) (primitive.ObjectID, error) {
+	filter := bson.M{"user_id": userID, "name": groupExpenseCategoryName, "type": categoryType, "deleted_at": nil}
+	category := models.Category{
+		ID:          primitive.NewObjectID(),
+		Name:        groupExpenseCategoryName,
+		Description: "Dibuat otomatis untuk transaksi patungan",
+		Type:        categoryType,
+		UserID:      userID,
+	}
+	result, err := database.CategoryCollection.UpdateOne(context.Background(), filter,
+		bson.M{"$setOnInsert": bson.M{"_id": category.ID, "description": category.Description}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	if result.UpsertedID != nil {
+		recordAudit(primitive.NilObjectID, userID, "categories", "create", category.ID, nil, &category)
+		return category.ID, nil
+	}
+
+	var existing models.Category
+	if err := database.CategoryCollection.FindOne(context.Background(), filter).Decode(&existing); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return existing.ID, nil
+}
+
+func groupExpenseDescription(ledger models.Ledger, description string) string {
+	if description == "" {
+		return "Patungan " + ledger.Name
+	}
+	return "Patungan " + ledger.Name + ": " + description
+}
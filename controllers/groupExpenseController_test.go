@@ -0,0 +1,336 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"finance-app/database"
+	"finance-app/models"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAllocateCentsKeepsTotal(t *testing.T) {
+	amounts := allocateCents(1000, []float64{1, 1, 1})
+	var total int64
+	for _, amount := range amounts {
+		total += amount
+	}
+	if total != 1000 {
+		t.Fatalf("allocated %v, total %d instead of 1000", amounts, total)
+	}
+	if amounts[0] != 334 || amounts[1] != 333 || amounts[2] != 333 {
+		t.Fatalf("remainder should go to one share only, got %v", amounts)
+	}
+}
+
+func TestComputeGroupShares(t *testing.T) {
+	alice, bob, carol := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	ledger := models.Ledger{Members: []models.LedgerMember{
+		{UserID: alice, Username: "alice", Status: "active"},
+		{UserID: bob, Username: "bob", Status: "active"},
+		{UserID: carol, Username: "carol", Status: "removed"},
+	}}
+
+	tests := []struct {
+		name    string
+		method  string
+		amount  float64
+		shares  []models.GroupExpenseShare
+		want    []float64
+		wantErr error
+	}{
+		{"equal", "equal", 100.01, []models.GroupExpenseShare{{UserID: alice}, {UserID: bob}}, []float64{50.01, 50}, nil},
+		{"shares by weight", "shares", 90, []models.GroupExpenseShare{{UserID: alice, Weight: 2}, {UserID: bob, Weight: 1}}, []float64{60, 30}, nil},
+		{"shares need positive weights", "shares", 90, []models.GroupExpenseShare{{UserID: alice, Weight: 2}, {UserID: bob}}, nil, errInvalidGroupShares},
+		{"exact", "exact", 100, []models.GroupExpenseShare{{UserID: alice, Amount: 70.004}, {UserID: bob, Amount: 29.996}}, []float64{70, 30}, nil},
+		{"exact total mismatch", "exact", 100, []models.GroupExpenseShare{{UserID: alice, Amount: 70}, {UserID: bob, Amount: 20}}, nil, errInvalidGroupShares},
+		{"exact negative amount", "exact", 100, []models.GroupExpenseShare{{UserID: alice, Amount: 110}, {UserID: bob, Amount: -10}}, nil, errInvalidGroupShares},
+		{"duplicate member", "equal", 100, []models.GroupExpenseShare{{UserID: alice}, {UserID: alice}}, nil, errInvalidGroupShares},
+		{"inactive member", "equal", 100, []models.GroupExpenseShare{{UserID: alice}, {UserID: carol}}, nil, errGroupMemberNotFound},
+		{"no shares", "equal", 100, nil, nil, errInvalidGroupShares},
+		{"non-positive amount", "equal", 0, []models.GroupExpenseShare{{UserID: alice}}, nil, errInvalidGroupExpense},
+		{"unknown method", "percent", 100, []models.GroupExpenseShare{{UserID: alice}}, nil, errInvalidGroupExpense},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expense := models.GroupExpense{Amount: tt.amount, Method: tt.method, Shares: tt.shares}
+			err := computeGroupShares(ledger, &expense)
+			if err != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			for i, share := range expense.Shares {
+				if share.Amount != tt.want[i] {
+					t.Fatalf("share %d: expected %v, got %v", i, tt.want[i], share.Amount)
+				}
+				if share.Username == "" {
+					t.Fatalf("share %d: username was not filled in", i)
+				}
+			}
+		})
+	}
+}
+
+func TestSettlementTransfers(t *testing.T) {
+	ids := make([]primitive.ObjectID, 5)
+	for i := range ids {
+		ids[i] = primitive.NewObjectID()
+	}
+	balances := func(nets ...float64) []groupBalance {
+		result := make([]groupBalance, len(nets))
+		for i, net := range nets {
+			result[i] = groupBalance{UserID: ids[i], Username: string(rune('a' + i)), Net: net}
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		balances []groupBalance
+		want     []groupTransfer
+	}{
+		{"settled", balances(0, 0), []groupTransfer{}},
+		{"one debtor", balances(50, -50), []groupTransfer{
+			{FromUserID: ids[1], FromUsername: "b", ToUserID: ids[0], ToUsername: "a", Amount: 50},
+		}},
+		{"largest debtor pays largest creditor", balances(60, 30, -70, -20), []groupTransfer{
+			{FromUserID: ids[2], FromUsername: "c", ToUserID: ids[0], ToUsername: "a", Amount: 60},
+			{FromUserID: ids[3], FromUsername: "d", ToUserID: ids[1], ToUsername: "b", Amount: 20},
+			{FromUserID: ids[2], FromUsername: "c", ToUserID: ids[1], ToUsername: "b", Amount: 10},
+		}},
+		{"matching pairs need one transfer each", balances(40, 10, -10, -40, 0), []groupTransfer{
+			{FromUserID: ids[3], FromUsername: "d", ToUserID: ids[0], ToUsername: "a", Amount: 40},
+			{FromUserID: ids[2], FromUsername: "c", ToUserID: ids[1], ToUsername: "b", Amount: 10},
+		}},
+		{"cents", balances(0.03, -0.01, -0.02), []groupTransfer{
+			{FromUserID: ids[2], FromUsername: "c", ToUserID: ids[0], ToUsername: "a", Amount: 0.02},
+			{FromUserID: ids[1], FromUsername: "b", ToUserID: ids[0], ToUsername: "a", Amount: 0.01},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := settlementTransfers(tt.balances)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+			members := 0
+			for _, balance := range tt.balances {
+				if balance.Net != 0 {
+					members++
+				}
+			}
+			if members > 0 && len(got) > members-1 {
+				t.Fatalf("%d transfers for %d unsettled members", len(got), members)
+			}
+		})
+	}
+}
+
+// Fungsi helper untuk ledger bersama dengan anggota aktif sesuai urutan users
+func createTestLedger(t *testing.T, users ...primitive.ObjectID) models.Ledger {
+	t.Helper()
+	ledger := models.Ledger{ID: primitive.NewObjectID(), Name: "Liburan", OwnerID: users[0], CreatedAt: time.Now()}
+	for i, userID := range users {
+		role := "editor"
+		if i == 0 {
+			role = "owner"
+		}
+		ledger.Members = append(ledger.Members, models.LedgerMember{UserID: userID, Username: userID.Hex()[18:], Role: role, Status: "active"})
+	}
+	if _, err := database.LedgerCollection.InsertOne(context.Background(), ledger); err != nil {
+		t.Fatal(err)
+	}
+	return ledger
+}
+
+func groupRequest(method, path string, ledgerID, actorID primitive.ObjectID, vars map[string]string, body interface{}) *http.Request {
+	data, _ := json.Marshal(body)
+	r := httptest.NewRequest(method, path, bytes.NewReader(data))
+	ctx := context.WithValue(r.Context(), "ledger_id", ledgerID)
+	ctx = context.WithValue(ctx, "user_id", actorID)
+	return mux.SetURLVars(r.WithContext(ctx), vars)
+}
+
+func TestGroupExpenseOnlyWritesPayerLedger(t *testing.T) {
+	setupTestDatabase(t)
+	alice, bob := primitive.NewObjectID(), primitive.NewObjectID()
+	ledger := createTestLedger(t, alice, bob)
+
+	// Bob tidak boleh mencatat patungan atas nama Alice
+	w := httptest.NewRecorder()
+	CreateGroupExpense(w, groupRequest(http.MethodPost, "/group-expenses", ledger.ID, bob, nil,
+		map[string]interface{}{"paid_by": alice, "amount": 100}))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another payer, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	CreateGroupExpense(w, groupRequest(http.MethodPost, "/group-expenses", ledger.ID, alice, nil,
+		map[string]interface{}{"amount": 100}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+
+	if count, _ := database.TransactionCollection.CountDocuments(context.Background(), bson.M{"user_id": bob}); count != 0 {
+		t.Fatalf("expense wrote %d transactions into the other member's ledger", count)
+	}
+	alicePosition, _ := computeBalanceState(alice)
+	if alicePosition.TotalExpense != 50 {
+		t.Fatalf("payer should book only their share 50, got %v", alicePosition.TotalExpense)
+	}
+
+	// Bob mengonfirmasi bagiannya sendiri
+	var entry models.GroupEntry
+	if err := database.GroupEntryCollection.FindOne(context.Background(), bson.M{"user_id": bob, "status": "pending"}).Decode(&entry); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	ConfirmGroupEntry(w, groupRequest(http.MethodPost, "/group-expenses/entries/"+entry.ID.Hex()+"/confirm", bob, bob,
+		map[string]string{"id": entry.ID.Hex()}, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("confirm: %d %s", w.Code, w.Body.String())
+	}
+	bobPosition, _ := computeBalanceState(bob)
+	if bobPosition.TotalExpense != 50 {
+		t.Fatalf("confirmed share should book 50, got %v", bobPosition.TotalExpense)
+	}
+
+	// Konfirmasi kedua tidak mencatat ulang
+	w = httptest.NewRecorder()
+	ConfirmGroupEntry(w, groupRequest(http.MethodPost, "/group-expenses/entries/"+entry.ID.Hex()+"/confirm", bob, bob,
+		map[string]string{"id": entry.ID.Hex()}, nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an already confirmed entry, got %d", w.Code)
+	}
+}
+
+func TestConcurrentSettlementsRespectCap(t *testing.T) {
+	setupTestDatabase(t)
+	alice, bob := primitive.NewObjectID(), primitive.NewObjectID()
+	ledger := createTestLedger(t, alice, bob)
+
+	w := httptest.NewRecorder()
+	CreateGroupExpense(w, groupRequest(http.MethodPost, "/group-expenses", ledger.ID, alice, nil,
+		map[string]interface{}{"amount": 100}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+
+	// Bob berhutang 50; sepuluh pelunasan 30 bersamaan hanya boleh lolos satu
+	var wg sync.WaitGroup
+	codes := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			CreateGroupSettlement(w, groupRequest(http.MethodPost, "/group-expenses/settlements", ledger.ID, bob, nil,
+				map[string]interface{}{"to_user_id": alice, "amount": 30}))
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	created := 0
+	for code := range codes {
+		if code == http.StatusCreated {
+			created++
+		} else if code != http.StatusBadRequest {
+			t.Fatalf("unexpected status %d", code)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("expected exactly one settlement within the cap, got %d", created)
+	}
+
+	balances, err := groupBalances(ledger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, balance := range balances {
+		if balance.UserID == bob && balance.Net != -20 {
+			t.Fatalf("bob should still owe 20, net is %v", balance.Net)
+		}
+	}
+
+	// Posisi tersimpan harus sama dengan hasil hitung ulang dari patungan dan pelunasan
+	stored, _ := loadGroupPositions(ledger)
+	recomputed, err := computeGroupPositions(ledger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for hex, member := range recomputed.Members {
+		if got := stored.Members[hex]; got.Net != member.Net || got.Paid != member.Paid || got.Owed != member.Owed {
+			t.Fatalf("stored position %+v differs from recomputed %+v", got, member)
+		}
+	}
+}
+
+func TestSettlementBooksBothSides(t *testing.T) {
+	setupTestDatabase(t)
+	alice, bob := primitive.NewObjectID(), primitive.NewObjectID()
+	ledger := createTestLedger(t, alice, bob)
+
+	w := httptest.NewRecorder()
+	CreateGroupExpense(w, groupRequest(http.MethodPost, "/group-expenses", ledger.ID, alice, nil,
+		map[string]interface{}{"amount": 100}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	CreateGroupSettlement(w, groupRequest(http.MethodPost, "/group-expenses/settlements", ledger.ID, bob, nil,
+		map[string]interface{}{"to_user_id": alice, "amount": 50}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("settlement: %d %s", w.Code, w.Body.String())
+	}
+	var settlement models.GroupSettlement
+	json.NewDecoder(w.Body).Decode(&settlement)
+	if settlement.FromTransactionID == nil {
+		t.Fatal("settlement should link the sender's transaction")
+	}
+
+	// Pengirim langsung mencatat pengeluarannya sendiri
+	bobPosition, _ := computeBalanceState(bob)
+	if bobPosition.TotalExpense != 50 {
+		t.Fatalf("sender should book the settlement as a 50 expense, got %v", bobPosition.TotalExpense)
+	}
+
+	// Penerima hanya mendapat entri pemasukan sampai mengonfirmasinya
+	var entry models.GroupEntry
+	if err := database.GroupEntryCollection.FindOne(context.Background(), bson.M{"user_id": alice, "status": "pending"}).Decode(&entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Type != "income" || entry.GroupSettlementID == nil || *entry.GroupSettlementID != settlement.ID {
+		t.Fatalf("unexpected receiver entry %+v", entry)
+	}
+	w = httptest.NewRecorder()
+	ConfirmGroupEntry(w, groupRequest(http.MethodPost, "/group-expenses/entries/"+entry.ID.Hex()+"/confirm", alice, alice,
+		map[string]string{"id": entry.ID.Hex()}, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("confirm: %d %s", w.Code, w.Body.String())
+	}
+	alicePosition, _ := computeBalanceState(alice)
+	if alicePosition.TotalIncome != 50 {
+		t.Fatalf("receiver should book the settlement as 50 income, got %v", alicePosition.TotalIncome)
+	}
+	var stored models.GroupSettlement
+	if err := database.GroupSettlementCollection.FindOne(context.Background(), bson.M{"_id": settlement.ID}).Decode(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.ToTransactionID == nil {
+		t.Fatal("confirmed entry should link the receiver's transaction to the settlement")
+	}
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"finance-app/config"
+	"finance-app/database"
+	"finance-app/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errInvalidDateRange = errors.New("Invalid date range. Use start_date and end_date in YYYY-MM-DD format")
+
+// Fungsi helper untuk membaca start_date dan end_date (format YYYY-MM-DD) dari query string.
+// Jika keduanya kosong, dipakai rentang bulan ini. Nilai end yang dikembalikan bersifat
+// eksklusif (awal hari setelah end_date) sehingga dipakai dengan $lt.
+func parseDateRange(r *http.Request) (time.Time, time.Time, error) {
+	startDateStr := r.URL.Query().Get("start_date")
+	endDateStr := r.URL.Query().Get("end_date")
+
+	if startDateStr == "" && endDateStr == "" {
+		now := time.Now()
+		currentYear, currentMonth, _ := now.Date()
+		firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, time.Local)
+		return firstOfMonth, firstOfMonth.AddDate(0, 1, 0), nil
+	}
+
+	startDate, err := time.Parse("2006-01-02", startDateStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, errInvalidDateRange
+	}
+	endDate, err := time.Parse("2006-01-02", endDateStr)
+	if err != nil || endDate.Before(startDate) {
+		return time.Time{}, time.Time{}, errInvalidDateRange
+	}
+
+	return startDate, endDate.AddDate(0, 0, 1), nil
+}
+
+var (
+	errIfMatchRequired = errors.New("If-Match header is required")
+	errInvalidIfMatch  = errors.New("Invalid If-Match header. Use the ETag returned by the API")
+	errVersionMismatch = errors.New("Document was modified by another request; reload and try again")
+)
+
+// Fungsi helper untuk membuat ETag dari versi dokumen
+func versionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// Fungsi helper untuk membaca versi yang diharapkan dari header If-Match. present bernilai
+// false jika header tidak dikirim atau bernilai "*". Jika REQUIRE_IF_MATCH=true, header wajib ada.
+func parseIfMatch(r *http.Request) (version int64, present bool, err error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		if config.GetEnv("REQUIRE_IF_MATCH", "false") == "true" {
+			return 0, false, errIfMatchRequired
+		}
+		return 0, false, nil
+	}
+	if header == "*" {
+		return 0, false, nil
+	}
+
+	header = strings.TrimPrefix(header, "W/")
+	version, err = strconv.ParseInt(strings.Trim(header, `"`), 10, 64)
+	if err != nil || version < 0 {
+		return 0, false, errInvalidIfMatch
+	}
+	return version, true, nil
+}
+
+// Fungsi helper untuk status HTTP dari error parseIfMatch
+func ifMatchErrorStatus(err error) int {
+	if err == errIfMatchRequired {
+		return http.StatusPreconditionRequired
+	}
+	return http.StatusBadRequest
+}
+
+// Fungsi helper untuk filter versi. Dokumen lama tanpa field version dianggap versi 0.
+func versionFilter(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
+
+var errInvalidTimezone = errors.New("Invalid timezone. Use an IANA name such as 'Asia/Jakarta'")
+
+// Fungsi helper untuk zona waktu laporan: ?tz= jika ada, lalu zona waktu di profil user
+// yang login, lalu UTC
+func userLocation(r *http.Request) (*time.Location, error) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		userID := r.Context().Value("user_id").(primitive.ObjectID)
+		var user models.User
+		opts := options.FindOne().SetProjection(bson.M{"timezone": 1})
+		err := database.UserCollection.FindOne(context.Background(), bson.M{"_id": userID}, opts).Decode(&user)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		name = user.Timezone
+	}
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, errInvalidTimezone
+	}
+	return location, nil
+}
@@ -3,100 +3,252 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"sort"
+	"time"
 
 	"finance-app/database"
+	"finance-app/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// Jangka waktu tagihan mendatang yang ditampilkan di beranda
+const upcomingBillsDays = 30
+
+var (
+	errInvalidHomePeriod = errors.New("Invalid period. Must be 'this_month', 'last_30d' or 'custom'")
+	errInvalidHomeRange  = errors.New("Invalid custom period. Use from and to in YYYY-MM-DD format")
+)
+
+type periodTotals struct {
+	Start   string  `json:"start"`
+	End     string  `json:"end"` // Inklusif
+	Income  float64 `json:"income"`
+	Expense float64 `json:"expense"`
+	Net     float64 `json:"net"`
+	Count   int     `json:"count"`
+}
+
+type periodChange struct {
+	Income         float64  `json:"income"`
+	Expense        float64  `json:"expense"`
+	Net            float64  `json:"net"`
+	IncomePercent  *float64 `json:"income_percent"` // nil jika periode sebelumnya bernilai nol
+	ExpensePercent *float64 `json:"expense_percent"`
+}
+
+type typeTotal struct {
+	Type  string  `bson:"_id"`
+	Total float64 `bson:"total"`
+	Count int     `bson:"count"`
+}
+
+type homeCategoryTotal struct {
+	CategoryID   primitive.ObjectID `bson:"category_id" json:"category_id"`
+	CategoryName string             `bson:"category_name" json:"category_name"`
+	Total        float64            `bson:"total" json:"total"`
+}
+
+// GetHomeData mengembalikan ringkasan beranda untuk ?period=this_month (default),
+// last_30d, atau custom (dengan from dan to, YYYY-MM-DD). Hanya data periode (total,
+// pembanding, kategori teratas dan transaksi terakhir) yang dihitung dalam satu pipeline
+// $facet. Saldo dan total sepanjang waktu dibaca dari snapshot saldo agar tidak perlu
+// menjumlahkan seluruh transaksi, dan tagihan mendatang adalah cicilan terjadwal yang
+// disimpan di koleksi rencana cicilan. Transaksi tidak bisa bertanggal di masa depan
+// karena tanggalnya diisi server.
 func GetHomeData(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(primitive.ObjectID)
-
-	// 1. Hitung Saldo Saat Ini
-	var currentBalance float64
-	matchStage := bson.D{{"$match", bson.D{{"user_id", userID}}}}
-	groupStage := bson.D{{"$group", bson.D{
-		{"_id", nil},
-		{"totalIncome", bson.D{{"$sum", bson.D{{"$cond", bson.A{
-			bson.D{{"$eq", bson.A{"$type", "income"}}},
-			"$amount",
-			0,
-		}}}}}},
-		{"totalExpense", bson.D{{"$sum", bson.D{{"$cond", bson.A{
-			bson.D{{"$eq", bson.A{"$type", "expense"}}},
-			"$amount",
-			0,
-		}}}}}},
-	}}}
-
-	cursor, err := database.TransactionCollection.Aggregate(context.Background(), mongo.Pipeline{matchStage, groupStage})
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	location, err := userLocation(r)
+	if err == errInvalidTimezone {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Error loading user timezone", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().In(location)
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "this_month"
+	}
+	start, end, prevStart, err := homePeriod(r, period, now)
 	if err != nil {
-		http.Error(w, "Error calculating current balance", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer cursor.Close(context.Background())
 
-	var result []bson.M
-	if err = cursor.All(context.Background(), &result); err != nil {
-		http.Error(w, "Error decoding balance result", http.StatusInternalServerError)
+	// Saldo dan total sepanjang waktu dibaca dari snapshot yang diperbarui setiap transaksi ditulis
+	snapshot, err := getBalanceSnapshot(ledgerID)
+	if err != nil {
+		http.Error(w, "Error calculating current balance", http.StatusInternalServerError)
 		return
 	}
 
-	if len(result) > 0 {
-		currentBalance = result[0]["totalIncome"].(float64) - result[0]["totalExpense"].(float64)
+	inPeriod := bson.M{"date": bson.M{"$gte": start, "$lt": end}}
+	totalsByType := bson.M{"$group": bson.M{
+		"_id":   "$type",
+		"total": bson.M{"$sum": "$amount"},
+		"count": bson.M{"$sum": 1},
+	}}
+
+	topCategories := []bson.M{{"$match": bson.M{"date": bson.M{"$gte": start, "$lt": end}, "type": "expense"}}}
+	topCategories = append(topCategories, database.SplitLineStages()...)
+	topCategories = append(topCategories,
+		bson.M{"$group": bson.M{"_id": "$category_id", "total": bson.M{"$sum": "$amount"}}},
+		bson.M{"$sort": bson.D{{Key: "total", Value: -1}}},
+		bson.M{"$limit": 5},
+		bson.M{"$lookup": bson.M{
+			"from":         "categories",
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "category",
+		}},
+		bson.M{"$project": bson.M{
+			"_id":           0,
+			"category_id":   "$_id",
+			"category_name": bson.M{"$first": "$category.name"},
+			"total":         1,
+		}},
+	)
+
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"user_id":    ledgerID,
+			"deleted_at": nil,
+			"date":       bson.M{"$gte": prevStart, "$lt": end},
+		}},
+		{"$facet": bson.M{
+			"current":        []bson.M{{"$match": inPeriod}, totalsByType},
+			"previous":       []bson.M{{"$match": bson.M{"date": bson.M{"$gte": prevStart, "$lt": start}}}, totalsByType},
+			"top_categories": topCategories,
+			"recent": []bson.M{
+				{"$match": inPeriod},
+				{"$sort": bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}}},
+				{"$limit": 5},
+			},
+		}},
 	}
 
-	// 2. Hitung Total Pengeluaran (All Time)
-	filter := bson.M{"user_id": userID, "type": "expense"}
-	totalExpense, err := calculateTotalAmount(filter)
+	cursor, err := database.TransactionCollection.Aggregate(context.Background(), pipeline)
 	if err != nil {
-		http.Error(w, "Error calculating total expense", http.StatusInternalServerError)
+		http.Error(w, "Error loading home data", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	var result []struct {
+		Current       []typeTotal          `bson:"current"`
+		Previous      []typeTotal          `bson:"previous"`
+		TopCategories []homeCategoryTotal  `bson:"top_categories"`
+		Recent        []models.Transaction `bson:"recent"`
+	}
+	if err = cursor.All(context.Background(), &result); err != nil || len(result) == 0 {
+		http.Error(w, "Error decoding home data", http.StatusInternalServerError)
 		return
 	}
+	facets := result[0]
+
+	// Slice kosong dikirim sebagai [] dan bukan null
+	if facets.TopCategories == nil {
+		facets.TopCategories = []homeCategoryTotal{}
+	}
+	if facets.Recent == nil {
+		facets.Recent = []models.Transaction{}
+	}
 
-	// 3. Hitung Total Pemasukan (All Time)
-	filter = bson.M{"user_id": userID, "type": "income"}
-	totalIncome, err := calculateTotalAmount(filter)
+	// Tagihan mendatang adalah cicilan terjadwal dalam upcomingBillsDays ke depan
+	upcoming, err := upcomingInstallments(ledgerID, now, now.AddDate(0, 0, upcomingBillsDays))
 	if err != nil {
-		http.Error(w, "Error calculating total income", http.StatusInternalServerError)
+		http.Error(w, "Error loading upcoming installments", http.StatusInternalServerError)
 		return
 	}
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return upcoming[i].Date.Before(upcoming[j].Date)
+	})
+	if len(upcoming) > 5 {
+		upcoming = upcoming[:5]
+	}
+
+	current := sumPeriodTotals(facets.Current, start, end)
+	previous := sumPeriodTotals(facets.Previous, prevStart, start)
+	change := periodChange{
+		Income:         current.Income - previous.Income,
+		Expense:        current.Expense - previous.Expense,
+		Net:            current.Net - previous.Net,
+		IncomePercent:  percentChange(previous.Income, current.Income),
+		ExpensePercent: percentChange(previous.Expense, current.Expense),
+	}
 
 	// Kirim respons
 	homeData := map[string]interface{}{
-		"current_balance": currentBalance,
-		"total_expense":   totalExpense,
-		"total_income":    totalIncome,
+		"current_balance":        snapshot.TotalIncome - snapshot.TotalExpense,
+		"total_expense":          snapshot.TotalExpense,
+		"total_income":           snapshot.TotalIncome,
+		"period":                 period,
+		"period_totals":          current,
+		"previous_period":        previous,
+		"change":                 change,
+		"top_expense_categories": facets.TopCategories,
+		"recent_transactions":    facets.Recent,
+		"upcoming_bills":         upcoming,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(homeData)
 }
 
-// Fungsi helper untuk menghitung total amount berdasarkan filter
-func calculateTotalAmount(filter bson.M) (float64, error) {
-	groupStage := bson.D{{"$group", bson.D{
-		{"_id", nil},
-		{"total", bson.D{{"$sum", "$amount"}}},
-	}}}
+// Fungsi helper untuk menentukan awal dan akhir (eksklusif) periode beranda, serta awal
+// periode sebelumnya yang panjangnya sama
+func homePeriod(r *http.Request, period string, now time.Time) (start, end, prevStart time.Time, err error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
 
-	cursor, err := database.TransactionCollection.Aggregate(context.Background(), mongo.Pipeline{
-		bson.D{{"$match", filter}},
-		groupStage,
-	})
-	if err != nil {
-		return 0, err
+	switch period {
+	case "this_month":
+		start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 1, 0), start.AddDate(0, -1, 0), nil
+	case "last_30d":
+		start = today.AddDate(0, 0, -29)
+		return start, today.AddDate(0, 0, 1), start.AddDate(0, 0, -30), nil
+	case "custom":
+		start, err = time.ParseInLocation("2006-01-02", r.URL.Query().Get("from"), now.Location())
+		if err != nil {
+			return start, end, prevStart, errInvalidHomeRange
+		}
+		to, err := time.ParseInLocation("2006-01-02", r.URL.Query().Get("to"), now.Location())
+		if err != nil || to.Before(start) {
+			return start, end, prevStart, errInvalidHomeRange
+		}
+		end = to.AddDate(0, 0, 1)
+		days := int(end.Sub(start).Hours()/24 + 0.5)
+		return start, end, start.AddDate(0, 0, -days), nil
 	}
-	defer cursor.Close(context.Background())
+	return start, end, prevStart, errInvalidHomePeriod
+}
 
-	var result []bson.M
-	if err = cursor.All(context.Background(), &result); err != nil {
-		return 0, err
+func sumPeriodTotals(totals []typeTotal, start, end time.Time) periodTotals {
+	result := periodTotals{
+		Start: start.Format("2006-01-02"),
+		End:   end.AddDate(0, 0, -1).Format("2006-01-02"),
 	}
+	for _, total := range totals {
+		if total.Type == "income" {
+			result.Income += total.Total
+		} else {
+			result.Expense += total.Total
+		}
+		result.Count += total.Count
+	}
+	result.Net = result.Income - result.Expense
+	return result
+}
 
-	if len(result) > 0 {
-		return result[0]["total"].(float64), nil
+func percentChange(previous, current float64) *float64 {
+	if previous == 0 {
+		return nil
 	}
-	return 0, nil
+	percent := (current - previous) / previous * 100
+	return &percent
 }
@@ -0,0 +1,506 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"finance-app/database"
+	"finance-app/models"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxInstallmentMonths = 120
+
+var (
+	errInstallmentPlanNotFound = errors.New("Installment plan not found or not owned by user")
+	errInvalidInstallmentPlan  = errors.New("Installment plan needs a positive principal, 1 to 120 months and non-negative interest_rate and admin_fee")
+	errInstallmentPlanClosed   = errors.New("Installment plan is no longer active")
+)
+
+// CreateInstallmentPlan mencatat pembelian cicilan dan menyusun jadwalnya. Cicilan yang
+// sudah jatuh tempo (start_date di masa lalu) langsung dicatat sebagai transaksi.
+func CreateInstallmentPlan(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	var plan models.InstallmentPlan
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	plan.ID = primitive.NewObjectID()
+	plan.UserID = ledgerID
+	plan.Description = strings.TrimSpace(plan.Description)
+	plan.Status = "active"
+	plan.CreatedAt = time.Now()
+	if plan.StartDate.IsZero() {
+		plan.StartDate = addMonths(plan.CreatedAt, 1)
+	}
+
+	if plan.Principal <= 0 || plan.Months < 1 || plan.Months > maxInstallmentMonths || plan.InterestRate < 0 || plan.AdminFee < 0 {
+		http.Error(w, errInvalidInstallmentPlan.Error(), http.StatusBadRequest)
+		return
+	}
+	err := checkTransactionCategory(ledgerID, plan.CategoryID, "expense")
+	if err == nil {
+		err = checkTransactionPayee(ledgerID, plan.PayeeID)
+	}
+	if err != nil {
+		if isValidationError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "Error validating installment plan", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	plan.Installments = buildInstallmentSchedule(plan)
+	plan.Total = 0
+	for _, installment := range plan.Installments {
+		plan.Total += installment.Amount
+	}
+	plan.Total = math.Round(plan.Total*100) / 100
+
+	if _, err := database.InstallmentPlanCollection.InsertOne(context.Background(), plan); err != nil {
+		http.Error(w, "Error creating installment plan", http.StatusInternalServerError)
+		return
+	}
+
+	if err := postDueInstallments(plan, time.Now()); err != nil {
+		log.Printf("Error posting installments for plan %s: %v", plan.ID.Hex(), err)
+	}
+	if plan, err = findInstallmentPlan(ledgerID, plan.ID); err != nil {
+		http.Error(w, "Error fetching installment plan", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(plan)
+}
+
+// GetInstallmentPlans mengembalikan rencana cicilan user, opsional difilter ?status=
+func GetInstallmentPlans(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	filter := bson.M{"user_id": ledgerID}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := database.InstallmentPlanCollection.Find(context.Background(), filter, opts)
+	if err != nil {
+		http.Error(w, "Error fetching installment plans", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	plans := []models.InstallmentPlan{}
+	if err = cursor.All(context.Background(), &plans); err != nil {
+		http.Error(w, "Error decoding installment plans", http.StatusInternalServerError)
+		return
+	}
+	for i := range plans {
+		setInstallmentRemaining(&plans[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plans)
+}
+
+func GetInstallmentPlan(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	planID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid installment plan ID", http.StatusBadRequest)
+		return
+	}
+
+	plan, err := findInstallmentPlan(ledgerID, planID)
+	if err != nil {
+		writeInstallmentPlanError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// PayOffInstallmentPlan melunasi sisa cicilan sekaligus. Pokok dan biaya cicilan yang
+// belum dicatat dibayar dalam satu transaksi, bunganya dihapus, dan penalty opsional
+// ditambahkan. Cicilan yang tersisa ditandai "waived".
+func PayOffInstallmentPlan(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	planID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid installment plan ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Date    time.Time `json:"date"`
+		Penalty float64   `json:"penalty"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if request.Penalty < 0 {
+		http.Error(w, "penalty must not be negative", http.StatusBadRequest)
+		return
+	}
+	if request.Date.IsZero() {
+		request.Date = time.Now()
+	}
+
+	// Tandai rencana lebih dulu agar job pencatatan tidak mencatat cicilan yang sedang dilunasi
+	plan, err := closeInstallmentPlan(ledgerID, planID, "paid_off")
+	if err != nil {
+		writeInstallmentPlanError(w, err)
+		return
+	}
+
+	amount := request.Penalty
+	for _, installment := range plan.Installments {
+		if installment.Status == "scheduled" {
+			amount += installment.Principal + installment.Fee
+		}
+	}
+	amount = math.Round(amount*100) / 100
+
+	var payoffID primitive.ObjectID
+	if amount > 0 {
+		transaction := models.Transaction{
+			Type:              "expense",
+			CategoryID:        plan.CategoryID,
+			PayeeID:           plan.PayeeID,
+			Amount:            amount,
+			Description:       "Pelunasan cicilan: " + plan.Description,
+			Date:              request.Date,
+			InstallmentPlanID: &plan.ID,
+		}
+		if err := insertTransaction(actorID, ledgerID, &transaction); err != nil {
+			// Kembalikan status agar pelunasan bisa dicoba lagi
+			reopenInstallmentPlan(planID, "paid_off")
+			if isValidationError(err) {
+				http.Error(w, err.Error(), http.StatusConflict)
+			} else {
+				http.Error(w, "Error creating payoff transaction", http.StatusInternalServerError)
+			}
+			return
+		}
+		payoffID = transaction.ID
+	}
+
+	if plan, err = waiveScheduledInstallments(ledgerID, planID); err != nil {
+		// Buang transaksi pelunasan dan buka lagi rencananya agar cicilan tidak tetap
+		// "scheduled" di rencana yang sudah lunas
+		if !payoffID.IsZero() {
+			if err := trashTransaction(actorID, ledgerID, payoffID); err != nil {
+				log.Printf("installment plan %s: discarding payoff transaction %s: %v", planID.Hex(), payoffID.Hex(), err)
+				http.Error(w, "Error updating installment plan", http.StatusInternalServerError)
+				return
+			}
+		}
+		reopenInstallmentPlan(planID, "paid_off")
+		http.Error(w, "Error updating installment plan", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"plan": plan, "payoff_amount": amount})
+}
+
+// CancelInstallmentPlan membatalkan cicilan yang belum dicatat. Transaksi cicilan yang
+// sudah tercatat tidak diubah.
+func CancelInstallmentPlan(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	planID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid installment plan ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := closeInstallmentPlan(ledgerID, planID, "cancelled"); err != nil {
+		writeInstallmentPlanError(w, err)
+		return
+	}
+	plan, err := waiveScheduledInstallments(ledgerID, planID)
+	if err != nil {
+		http.Error(w, "Error updating installment plan", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// PostDueInstallments mencatat semua cicilan yang sudah jatuh tempo pada atau sebelum
+// now sebagai transaksi pengeluaran
+func PostDueInstallments(now time.Time) error {
+	filter := bson.M{
+		"status":       "active",
+		"installments": bson.M{"$elemMatch": bson.M{"status": "scheduled", "due_date": bson.M{"$lte": now}}},
+	}
+	cursor, err := database.InstallmentPlanCollection.Find(context.Background(), filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		var plan models.InstallmentPlan
+		if err := cursor.Decode(&plan); err != nil {
+			return err
+		}
+		if err := postDueInstallments(plan, now); err != nil {
+			log.Printf("Error posting installments for plan %s: %v", plan.ID.Hex(), err)
+		}
+	}
+	return cursor.Err()
+}
+
+// StartInstallmentPosting menjalankan PostDueInstallments secara berkala di background
+func StartInstallmentPosting(interval time.Duration) {
+	go func() {
+		for {
+			if err := PostDueInstallments(time.Now()); err != nil {
+				log.Printf("Error posting due installments: %v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Fungsi helper untuk mencatat cicilan rencana yang sudah jatuh tempo. Cicilan ditandai
+// "posted" lebih dulu dengan ID transaksi yang sudah disiapkan, sehingga job yang berjalan
+// bersamaan tidak mencatat cicilan yang sama dua kali.
+func postDueInstallments(plan models.InstallmentPlan, now time.Time) error {
+	for _, installment := range plan.Installments {
+		if installment.Status != "scheduled" || installment.DueDate.After(now) {
+			continue
+		}
+
+		transactionID := primitive.NewObjectID()
+		opts := options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"i.number": installment.Number}},
+		})
+		result, err := database.InstallmentPlanCollection.UpdateOne(context.Background(),
+			bson.M{
+				"_id":          plan.ID,
+				"status":       "active",
+				"installments": bson.M{"$elemMatch": bson.M{"number": installment.Number, "status": "scheduled"}},
+			},
+			bson.M{"$set": bson.M{
+				"installments.$[i].status":         "posted",
+				"installments.$[i].transaction_id": transactionID,
+			}}, opts)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+
+		transaction := models.Transaction{
+			ID:                transactionID,
+			Type:              "expense",
+			CategoryID:        plan.CategoryID,
+			PayeeID:           plan.PayeeID,
+			Amount:            installment.Amount,
+			Description:       fmt.Sprintf("Cicilan %d/%d: %s", installment.Number, plan.Months, plan.Description),
+			Date:              installment.DueDate,
+			InstallmentPlanID: &plan.ID,
+			InstallmentNumber: installment.Number,
+		}
+		if err := insertTransaction(primitive.NilObjectID, plan.UserID, &transaction); err != nil {
+			// Kembalikan ke "scheduled" agar dicoba lagi pada putaran berikutnya
+			database.InstallmentPlanCollection.UpdateOne(context.Background(),
+				bson.M{"_id": plan.ID},
+				bson.M{"$set": bson.M{"installments.$[i].status": "scheduled"}, "$unset": bson.M{"installments.$[i].transaction_id": ""}},
+				opts)
+			return err
+		}
+	}
+
+	// Rencana selesai jika tidak ada lagi cicilan yang terjadwal
+	_, err := database.InstallmentPlanCollection.UpdateOne(context.Background(),
+		bson.M{"_id": plan.ID, "status": "active", "installments.status": bson.M{"$ne": "scheduled"}},
+		bson.M{"$set": bson.M{"status": "completed"}})
+	return err
+}
+
+// Fungsi helper untuk menyusun jadwal cicilan. Pokok dan bunga dibagi rata dalam satuan
+// sen; selisih pembulatan masuk ke cicilan terakhir.
+func buildInstallmentSchedule(plan models.InstallmentPlan) []models.Installment {
+	principal := cents(plan.Principal)
+	interest := cents(plan.Principal * plan.InterestRate / 100 * float64(plan.Months))
+	months := int64(plan.Months)
+
+	installments := make([]models.Installment, plan.Months)
+	for i := range installments {
+		principalPart, interestPart := principal/months, interest/months
+		if int64(i) == months-1 {
+			principalPart = principal - principalPart*(months-1)
+			interestPart = interest - interestPart*(months-1)
+		}
+		installment := models.Installment{
+			Number:    i + 1,
+			DueDate:   addMonths(plan.StartDate, i),
+			Principal: float64(principalPart) / 100,
+			Interest:  float64(interestPart) / 100,
+			Status:    "scheduled",
+		}
+		if i == 0 {
+			installment.Fee = float64(cents(plan.AdminFee)) / 100
+		}
+		installment.Amount = float64(principalPart+interestPart+cents(installment.Fee)) / 100
+		installments[i] = installment
+	}
+	return installments
+}
+
+// Fungsi helper untuk menambah bulan tanpa melompat ke bulan berikutnya, misalnya
+// 31 Januari + 1 bulan menjadi 28/29 Februari
+func addMonths(date time.Time, months int) time.Time {
+	firstOfMonth := time.Date(date.Year(), date.Month()+time.Month(months), 1, date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), date.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	day := date.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
+
+func findInstallmentPlan(userID, planID primitive.ObjectID) (models.InstallmentPlan, error) {
+	var plan models.InstallmentPlan
+	err := database.InstallmentPlanCollection.FindOne(context.Background(), bson.M{"_id": planID, "user_id": userID}).Decode(&plan)
+	if err == mongo.ErrNoDocuments {
+		return plan, errInstallmentPlanNotFound
+	}
+	setInstallmentRemaining(&plan)
+	return plan, err
+}
+
+// Fungsi helper untuk mengubah status rencana yang masih aktif. Jika rencana ada tetapi
+// sudah tidak aktif, dikembalikan errInstallmentPlanClosed.
+func closeInstallmentPlan(userID, planID primitive.ObjectID, status string) (models.InstallmentPlan, error) {
+	var plan models.InstallmentPlan
+	err := database.InstallmentPlanCollection.FindOneAndUpdate(context.Background(),
+		bson.M{"_id": planID, "user_id": userID, "status": "active"},
+		bson.M{"$set": bson.M{"status": status}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&plan)
+	if err == mongo.ErrNoDocuments {
+		if _, err := findInstallmentPlan(userID, planID); err != nil {
+			return plan, err
+		}
+		return plan, errInstallmentPlanClosed
+	}
+	return plan, err
+}
+
+// Fungsi helper untuk mengembalikan rencana yang baru ditutup ke status "active" saat
+// langkah berikutnya gagal
+func reopenInstallmentPlan(planID primitive.ObjectID, status string) {
+	if _, err := database.InstallmentPlanCollection.UpdateOne(context.Background(),
+		bson.M{"_id": planID, "status": status}, bson.M{"$set": bson.M{"status": "active"}}); err != nil {
+		log.Printf("installment plan %s: reopening after failed %s: %v", planID.Hex(), status, err)
+	}
+}
+
+func waiveScheduledInstallments(userID, planID primitive.ObjectID) (models.InstallmentPlan, error) {
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"i.status": "scheduled"}},
+	})
+	_, err := database.InstallmentPlanCollection.UpdateOne(context.Background(),
+		bson.M{"_id": planID, "user_id": userID},
+		bson.M{"$set": bson.M{"installments.$[i].status": "waived"}}, opts)
+	if err != nil {
+		return models.InstallmentPlan{}, err
+	}
+	return findInstallmentPlan(userID, planID)
+}
+
+func setInstallmentRemaining(plan *models.InstallmentPlan) {
+	var remaining int64
+	for _, installment := range plan.Installments {
+		if installment.Status == "scheduled" {
+			remaining += cents(installment.Amount)
+		}
+	}
+	plan.Remaining = float64(remaining) / 100
+}
+
+func writeInstallmentPlanError(w http.ResponseWriter, err error) {
+	switch err {
+	case errInstallmentPlanNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errInstallmentPlanClosed:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Error processing installment plan", http.StatusInternalServerError)
+	}
+}
+
+// Fungsi helper untuk cicilan terjadwal yang jatuh tempo sebelum end, dalam bentuk
+// transaksi agar bisa digabung dengan tagihan mendatang di beranda
+func upcomingInstallments(userID primitive.ObjectID, now, end time.Time) ([]models.Transaction, error) {
+	cursor, err := database.InstallmentPlanCollection.Find(context.Background(), bson.M{
+		"user_id":      userID,
+		"status":       "active",
+		"installments": bson.M{"$elemMatch": bson.M{"status": "scheduled", "due_date": bson.M{"$lt": end}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var plans []models.InstallmentPlan
+	if err = cursor.All(context.Background(), &plans); err != nil {
+		return nil, err
+	}
+
+	upcoming := []models.Transaction{}
+	for i := range plans {
+		plan := plans[i]
+		for _, installment := range plan.Installments {
+			if installment.Status != "scheduled" || installment.DueDate.Before(now) || !installment.DueDate.Before(end) {
+				continue
+			}
+			upcoming = append(upcoming, models.Transaction{
+				UserID:            userID,
+				Type:              "expense",
+				CategoryID:        plan.CategoryID,
+				PayeeID:           plan.PayeeID,
+				Amount:            installment.Amount,
+				Description:       fmt.Sprintf("Cicilan %d/%d: %s", installment.Number, plan.Months, plan.Description),
+				Date:              installment.DueDate,
+				InstallmentPlanID: &plans[i].ID,
+				InstallmentNumber: installment.Number,
+			})
+		}
+	}
+	return upcoming, nil
+}
@@ -0,0 +1,14 @@
+package controllers
+
+import (
+	"encoding/json"
+	"finance-app/utils"
+	"net/http"
+)
+
+// GetJWKS menerbitkan kunci publik untuk memverifikasi access token (RS256/ES256)
+func GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(utils.JWKS())
+}
@@ -0,0 +1,556 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"finance-app/database"
+	"finance-app/models"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errLedgerNotFound     = errors.New("Ledger not found or you are not a member")
+	errLedgerNameRequired = errors.New("Ledger name is required")
+	errLedgerOwnerOnly    = errors.New("Only the ledger owner can do this")
+	errInvalidLedgerRole  = errors.New("Invalid role. Must be 'editor' or 'viewer'")
+	errLedgerMemberExists = errors.New("User is already a member of or invited to this ledger")
+	errLedgerMemberAbsent = errors.New("User is not a member of this ledger")
+	errLedgerOwnerMember  = errors.New("The ledger owner cannot be removed or change role")
+	errInviteeNotFound    = errors.New("User not found")
+)
+
+// ledgerView adalah ledger yang dapat diakses user beserta perannya. Ledger pribadi
+// ditampilkan dengan Personal true dan ID user sebagai ID ledger.
+type ledgerView struct {
+	ID       primitive.ObjectID `json:"id"`
+	Name     string             `json:"name"`
+	Role     string             `json:"role"`
+	Status   string             `json:"status"`
+	Personal bool               `json:"personal"`
+	Members  int                `json:"members"`
+}
+
+// CreateLedger membuat ledger bersama baru dengan user sebagai owner
+func CreateLedger(w http.ResponseWriter, r *http.Request) {
+	// Ambil user ID dari context
+	userID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		http.Error(w, errLedgerNameRequired.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := findUserByID(userID)
+	if err != nil {
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	ledger := models.Ledger{
+		ID:      primitive.NewObjectID(),
+		Name:    request.Name,
+		OwnerID: userID,
+		Members: []models.LedgerMember{{
+			UserID:   userID,
+			Username: user.Username,
+			Role:     "owner",
+			Status:   "active",
+			JoinedAt: &now,
+		}},
+		CreatedAt: now,
+	}
+	if _, err := database.LedgerCollection.InsertOne(context.Background(), ledger); err != nil {
+		http.Error(w, "Error creating ledger", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ledger)
+}
+
+// GetLedgers mengembalikan ledger pribadi dan semua ledger bersama yang diikuti user,
+// termasuk undangan yang belum diterima (status "invited")
+func GetLedgers(w http.ResponseWriter, r *http.Request) {
+	// Ambil user ID dari context
+	userID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	user, err := findUserByID(userID)
+	if err != nil {
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := database.LedgerCollection.Find(context.Background(), bson.M{"members.user_id": userID, "deleted_at": nil}, opts)
+	if err != nil {
+		http.Error(w, "Error fetching ledgers", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	var ledgers []models.Ledger
+	if err = cursor.All(context.Background(), &ledgers); err != nil {
+		http.Error(w, "Error decoding ledgers", http.StatusInternalServerError)
+		return
+	}
+
+	views := []ledgerView{{ID: userID, Name: user.Username, Role: "owner", Status: "active", Personal: true, Members: 1}}
+	for _, ledger := range ledgers {
+		member, _ := ledgerMember(ledger, userID)
+		views = append(views, ledgerView{
+			ID:      ledger.ID,
+			Name:    ledger.Name,
+			Role:    member.Role,
+			Status:  member.Status,
+			Members: len(ledger.Members),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+func GetLedger(w http.ResponseWriter, r *http.Request) {
+	// Ambil user ID dari context
+	userID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	ledgerID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ledger ID", http.StatusBadRequest)
+		return
+	}
+
+	ledger, _, err := findLedgerForMember(userID, ledgerID, false)
+	if err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ledger)
+}
+
+// UpdateLedger mengganti nama ledger (khusus owner)
+func UpdateLedger(w http.ResponseWriter, r *http.Request) {
+	// Ambil user ID dari context
+	userID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	ledgerID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ledger ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		http.Error(w, errLedgerNameRequired.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := findLedgerForOwner(userID, ledgerID); err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+
+	var ledger models.Ledger
+	err = database.LedgerCollection.FindOneAndUpdate(context.Background(),
+		bson.M{"_id": ledgerID, "owner_id": userID, "deleted_at": nil},
+		bson.M{"$set": bson.M{"name": request.Name}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&ledger)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeLedgerError(w, errLedgerNotFound)
+		} else {
+			http.Error(w, "Error updating ledger", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ledger)
+}
+
+// DeleteLedger menutup ledger bersama (khusus owner). Anggota kehilangan akses, tetapi
+// data ledger tidak dihapus.
+func DeleteLedger(w http.ResponseWriter, r *http.Request) {
+	// Ambil user ID dari context
+	userID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	ledgerID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ledger ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := findLedgerForOwner(userID, ledgerID); err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+	_, err = database.LedgerCollection.UpdateOne(context.Background(),
+		bson.M{"_id": ledgerID, "owner_id": userID, "deleted_at": nil},
+		bson.M{"$set": bson.M{"deleted_at": time.Now()}})
+	if err != nil {
+		http.Error(w, "Error deleting ledger", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Ledger deleted successfully"})
+}
+
+// InviteLedgerMember mengundang user berdasarkan username sebagai editor atau viewer
+// (khusus owner). Undangan berlaku setelah diterima lewat POST /ledgers/{id}/accept.
+func InviteLedgerMember(w http.ResponseWriter, r *http.Request) {
+	// Ambil user ID dari context
+	userID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	ledgerID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ledger ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Username string `json:"username"`
+		Role     string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Role != "editor" && request.Role != "viewer" {
+		http.Error(w, errInvalidLedgerRole.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := findLedgerForOwner(userID, ledgerID); err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+
+	var invitee models.User
+	err = database.UserCollection.FindOne(context.Background(), bson.M{"username": strings.TrimSpace(request.Username)}).Decode(&invitee)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeLedgerError(w, errInviteeNotFound)
+		} else {
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	member := models.LedgerMember{
+		UserID:    invitee.ID,
+		Username:  invitee.Username,
+		Role:      request.Role,
+		Status:    "invited",
+		InvitedBy: userID,
+	}
+	// Filter memastikan user belum menjadi anggota meskipun ada undangan bersamaan
+	result, err := database.LedgerCollection.UpdateOne(context.Background(),
+		bson.M{"_id": ledgerID, "owner_id": userID, "deleted_at": nil, "members.user_id": bson.M{"$ne": invitee.ID}},
+		bson.M{"$push": bson.M{"members": member}})
+	if err != nil {
+		http.Error(w, "Error inviting member", http.StatusInternalServerError)
+		return
+	}
+	if result.MatchedCount == 0 {
+		writeLedgerError(w, errLedgerMemberExists)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(member)
+}
+
+// AcceptLedgerInvitation menerima undangan ke ledger. Menolak undangan dilakukan dengan
+// DELETE /ledgers/{id}/members/{user_id} untuk diri sendiri.
+func AcceptLedgerInvitation(w http.ResponseWriter, r *http.Request) {
+	// Ambil user ID dari context
+	userID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	ledgerID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ledger ID", http.StatusBadRequest)
+		return
+	}
+
+	var ledger models.Ledger
+	err = database.LedgerCollection.FindOneAndUpdate(context.Background(),
+		bson.M{
+			"_id":        ledgerID,
+			"deleted_at": nil,
+			"members":    bson.M{"$elemMatch": bson.M{"user_id": userID, "status": "invited"}},
+		},
+		bson.M{"$set": bson.M{"members.$.status": "active", "members.$.joined_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&ledger)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Invitation not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Error accepting invitation", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ledger)
+}
+
+// UpdateLedgerMember mengubah peran anggota menjadi editor atau viewer (khusus owner)
+func UpdateLedgerMember(w http.ResponseWriter, r *http.Request) {
+	// Ambil user ID dari context
+	userID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	params := mux.Vars(r)
+	ledgerID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid ledger ID", http.StatusBadRequest)
+		return
+	}
+	memberID, err := primitive.ObjectIDFromHex(params["user_id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Role != "editor" && request.Role != "viewer" {
+		http.Error(w, errInvalidLedgerRole.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ledger, err := findLedgerForOwner(userID, ledgerID)
+	if err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+	if memberID == ledger.OwnerID {
+		writeLedgerError(w, errLedgerOwnerMember)
+		return
+	}
+
+	err = database.LedgerCollection.FindOneAndUpdate(context.Background(),
+		bson.M{"_id": ledgerID, "deleted_at": nil, "members.user_id": memberID},
+		bson.M{"$set": bson.M{"members.$.role": request.Role}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&ledger)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeLedgerError(w, errLedgerMemberAbsent)
+		} else {
+			http.Error(w, "Error updating member", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ledger)
+}
+
+// RemoveLedgerMember mengeluarkan anggota (khusus owner). Anggota juga dapat
+// mengeluarkan dirinya sendiri untuk keluar dari ledger atau menolak undangan.
+func RemoveLedgerMember(w http.ResponseWriter, r *http.Request) {
+	// Ambil user ID dari context
+	userID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	params := mux.Vars(r)
+	ledgerID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid ledger ID", http.StatusBadRequest)
+		return
+	}
+	memberID, err := primitive.ObjectIDFromHex(params["user_id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	ledger, _, err := findLedgerForMember(userID, ledgerID, true)
+	if err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+	if memberID == ledger.OwnerID {
+		writeLedgerError(w, errLedgerOwnerMember)
+		return
+	}
+	if memberID != userID && userID != ledger.OwnerID {
+		writeLedgerError(w, errLedgerOwnerOnly)
+		return
+	}
+
+	result, err := database.LedgerCollection.UpdateOne(context.Background(),
+		bson.M{"_id": ledgerID, "deleted_at": nil},
+		bson.M{"$pull": bson.M{"members": bson.M{"user_id": memberID}}})
+	if err != nil {
+		http.Error(w, "Error removing member", http.StatusInternalServerError)
+		return
+	}
+	if result.ModifiedCount == 0 {
+		writeLedgerError(w, errLedgerMemberAbsent)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Member removed successfully"})
+}
+
+// GetMemberReport merangkum pemasukan dan pengeluaran ledger aktif per anggota yang
+// mencatatnya, dalam rentang ?start_date=&end_date=
+func GetMemberReport(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	startDate, endDate, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"user_id":    ledgerID,
+			"deleted_at": nil,
+			"date":       bson.M{"$gte": startDate, "$lt": endDate},
+		}},
+		{"$group": bson.M{
+			"_id": "$created_by",
+			"income": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$type", "income"}}, "$amount", 0,
+			}}},
+			"expense": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$type", "expense"}}, "$amount", 0,
+			}}},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$lookup": bson.M{
+			"from":         "users",
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "user",
+		}},
+		{"$project": bson.M{
+			"_id":      0,
+			"user_id":  "$_id",
+			"username": bson.M{"$first": "$user.username"},
+			"income":   1,
+			"expense":  1,
+			"count":    1,
+		}},
+		{"$sort": bson.D{{Key: "expense", Value: -1}, {Key: "income", Value: -1}}},
+	}
+
+	cursor, err := database.TransactionCollection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		http.Error(w, "Error generating member report", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	// Transaksi tanpa created_by (dicatat sebelum ada ledger bersama atau oleh job
+	// background) dikelompokkan dengan user_id null
+	result := []struct {
+		UserID   *primitive.ObjectID `bson:"user_id" json:"user_id"`
+		Username string              `bson:"username" json:"username"`
+		Income   float64             `bson:"income" json:"income"`
+		Expense  float64             `bson:"expense" json:"expense"`
+		Count    int                 `bson:"count" json:"count"`
+	}{}
+	if err = cursor.All(context.Background(), &result); err != nil {
+		http.Error(w, "Error decoding member report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func writeLedgerError(w http.ResponseWriter, err error) {
+	switch err {
+	case errLedgerNotFound, errInviteeNotFound, errLedgerMemberAbsent:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errLedgerOwnerOnly:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errLedgerMemberExists, errLedgerOwnerMember:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Error processing ledger", http.StatusInternalServerError)
+	}
+}
+
+// Fungsi helper untuk ledger yang diikuti user. Anggota yang masih diundang hanya
+// diterima jika includeInvited bernilai true.
+func findLedgerForMember(userID, ledgerID primitive.ObjectID, includeInvited bool) (models.Ledger, models.LedgerMember, error) {
+	var ledger models.Ledger
+	err := database.LedgerCollection.FindOne(context.Background(), bson.M{"_id": ledgerID, "deleted_at": nil}).Decode(&ledger)
+	if err == mongo.ErrNoDocuments {
+		return ledger, models.LedgerMember{}, errLedgerNotFound
+	} else if err != nil {
+		return ledger, models.LedgerMember{}, err
+	}
+
+	member, ok := ledgerMember(ledger, userID)
+	if !ok || (member.Status != "active" && !includeInvited) {
+		return ledger, member, errLedgerNotFound
+	}
+	return ledger, member, nil
+}
+
+func findLedgerForOwner(userID, ledgerID primitive.ObjectID) (models.Ledger, error) {
+	ledger, member, err := findLedgerForMember(userID, ledgerID, false)
+	if err != nil {
+		return ledger, err
+	}
+	if member.Role != "owner" {
+		return ledger, errLedgerOwnerOnly
+	}
+	return ledger, nil
+}
+
+func ledgerMember(ledger models.Ledger, userID primitive.ObjectID) (models.LedgerMember, bool) {
+	for _, member := range ledger.Members {
+		if member.UserID == userID {
+			return member, true
+		}
+	}
+	return models.LedgerMember{}, false
+}
+
+func findUserByID(userID primitive.ObjectID) (models.User, error) {
+	var user models.User
+	err := database.UserCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+	return user, err
+}
@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"finance-app/database"
+	"finance-app/models"
+	"finance-app/notify"
+	"finance-app/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	errEmptyPassword     = errors.New("New password must not be empty")
+	errInvalidResetToken = errors.New("Invalid or expired reset token")
+)
+
+const passwordResetAccepted = "If the account exists, a password reset token has been sent"
+
+// ChangePassword mengganti password user yang sedang login setelah password lama diverifikasi.
+// Semua sesi lain dicabut dan sesi yang dipakai mendapat access token baru.
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	// Ambil user ID dan sesi dari context
+	userID := r.Context().Value("user_id").(primitive.ObjectID)
+	sessionID := r.Context().Value("session_id").(primitive.ObjectID)
+
+	var request struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.NewPassword == "" {
+		http.Error(w, errEmptyPassword.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	err := database.UserCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		http.Error(w, "Error finding user", http.StatusInternalServerError)
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.CurrentPassword)); err != nil {
+		http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+		return
+	}
+
+	if err := setPassword(userID, request.NewPassword); err != nil {
+		http.Error(w, "Error changing password", http.StatusInternalServerError)
+		return
+	}
+	version, err := revokeOtherSessions(userID, sessionID)
+	if err != nil {
+		http.Error(w, "Error revoking sessions", http.StatusInternalServerError)
+		return
+	}
+	// Access token lama ikut ditolak karena versi token naik, jadi sesi ini diberi yang baru
+	accessToken, err := utils.GenerateToken(userID, sessionID, version)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "Password changed successfully",
+		"token":      accessToken,
+		"expires_in": int64(utils.AccessTokenTTL().Seconds()),
+	})
+}
+
+// RequestPasswordReset menerbitkan token reset password dan mengirimkannya lewat notifier.
+// Respons selalu sama agar tidak bisa dipakai untuk menebak username yang terdaftar.
+func RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	err := database.UserCollection.FindOne(context.Background(), bson.M{"username": request.Username}).Decode(&user)
+	if err != nil && err != mongo.ErrNoDocuments {
+		http.Error(w, "Error finding user", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		if err := sendPasswordReset(r.Context(), user); err != nil {
+			log.Printf("Error sending password reset for user %s: %v", user.ID.Hex(), err)
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": passwordResetAccepted})
+}
+
+// ResetPassword mengganti password dengan token reset. Token hanya bisa dipakai sekali dan
+// semua sesi user dicabut setelah password diganti.
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Token == "" {
+		http.Error(w, errInvalidResetToken.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.NewPassword == "" {
+		http.Error(w, errEmptyPassword.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Tandai token sudah dipakai dalam satu operasi agar request bersamaan tidak bisa
+	// memakai token yang sama dua kali
+	now := time.Now()
+	var stored models.PasswordResetToken
+	err := database.PasswordResetCollection.FindOneAndUpdate(context.Background(),
+		bson.M{"token_hash": utils.HashToken(request.Token), "used_at": nil, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"used_at": now}}).Decode(&stored)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, errInvalidResetToken.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "Error finding reset token", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := setPassword(stored.UserID, request.NewPassword); err != nil {
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+	if err := revokeAllSessions(stored.UserID); err != nil {
+		http.Error(w, "Error revoking sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password reset successfully"})
+}
+
+// Fungsi helper untuk menyimpan hash password baru. Token reset yang belum dipakai ikut
+// dibatalkan karena dibuat untuk password lama.
+func setPassword(userID primitive.ObjectID, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	_, err = database.UserCollection.UpdateOne(context.Background(),
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"password": string(hashedPassword)}})
+	if err != nil {
+		return err
+	}
+	return invalidatePasswordResets(userID, time.Now())
+}
+
+// Fungsi helper untuk menandai semua token reset user yang belum dipakai sebagai terpakai
+func invalidatePasswordResets(userID primitive.ObjectID, now time.Time) error {
+	_, err := database.PasswordResetCollection.UpdateMany(context.Background(),
+		bson.M{"user_id": userID, "used_at": nil},
+		bson.M{"$set": bson.M{"used_at": now}})
+	return err
+}
+
+// Fungsi helper untuk menerbitkan token reset baru dan mengirimkannya ke user. Hanya token
+// terbaru yang berlaku.
+func sendPasswordReset(ctx context.Context, user models.User) error {
+	token, hash, err := utils.GeneratePasswordResetToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := invalidatePasswordResets(user.ID, now); err != nil {
+		return err
+	}
+	ttl := utils.PasswordResetTTL()
+	_, err = database.PasswordResetCollection.InsertOne(context.Background(), models.PasswordResetToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	subject := "Reset password"
+	body := fmt.Sprintf("Token reset password untuk %s:\n\n%s\n\nKirim token ini ke POST /auth/password/reset dalam %d menit. Abaikan pesan ini jika Anda tidak meminta reset password.\n",
+		user.Username, token, int(ttl.Minutes()))
+	if user.Locale == "en" {
+		body = fmt.Sprintf("Password reset token for %s:\n\n%s\n\nSend this token to POST /auth/password/reset within %d minutes. Ignore this message if you did not request a password reset.\n",
+			user.Username, token, int(ttl.Minutes()))
+	}
+	return notify.Users.Send(ctx, notify.Message{To: user.Email, Subject: subject, Body: body})
+}
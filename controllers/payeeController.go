@@ -0,0 +1,534 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"finance-app/database"
+	"finance-app/models"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	errPayeeNotFound     = errors.New("Payee not found or not owned by user")
+	errPayeeNameRequired = errors.New("Payee name is required")
+	errPayeeExists       = errors.New("A payee with this name already exists")
+)
+
+func CreatePayee(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	var payee models.Payee
+	if err := json.NewDecoder(r.Body).Decode(&payee); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payee.ID = primitive.NewObjectID()
+	payee.UserID = ledgerID
+	payee.CreatedAt = time.Now()
+
+	if err := validatePayee(ledgerID, &payee); err != nil {
+		writePayeeError(w, err)
+		return
+	}
+
+	if _, err := database.PayeeCollection.InsertOne(context.Background(), payee); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			writePayeeError(w, errPayeeExists)
+		} else {
+			http.Error(w, "Error creating payee", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(payee)
+}
+
+func GetPayees(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	payees, err := loadPayees(ledgerID)
+	if err != nil {
+		http.Error(w, "Error fetching payees", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payees)
+}
+
+func UpdatePayee(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	payeeID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid payee ID", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := findPayee(ledgerID, payeeID)
+	if err != nil {
+		writePayeeError(w, err)
+		return
+	}
+
+	var payee models.Payee
+	if err := json.NewDecoder(r.Body).Decode(&payee); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payee.ID = payeeID
+	payee.UserID = ledgerID
+	payee.CreatedAt = existing.CreatedAt
+
+	if err := validatePayee(ledgerID, &payee); err != nil {
+		writePayeeError(w, err)
+		return
+	}
+
+	if _, err := database.PayeeCollection.ReplaceOne(context.Background(), bson.M{"_id": payeeID, "user_id": ledgerID}, payee); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			writePayeeError(w, errPayeeExists)
+		} else {
+			http.Error(w, "Error updating payee", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payee)
+}
+
+// DeletePayee menghapus payee dan melepas tautannya dari semua transaksi
+func DeletePayee(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	payeeID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid payee ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := findPayee(ledgerID, payeeID); err != nil {
+		writePayeeError(w, err)
+		return
+	}
+
+	if err := relinkPayeeTransactions(actorID, ledgerID, payeeID, nil); err != nil {
+		http.Error(w, "Error unlinking payee transactions", http.StatusInternalServerError)
+		return
+	}
+	if _, err := database.PayeeCollection.DeleteOne(context.Background(), bson.M{"_id": payeeID, "user_id": ledgerID}); err != nil {
+		http.Error(w, "Error deleting payee", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Payee deleted successfully"})
+}
+
+// MergePayees menggabungkan payee {"source_ids": [...]} ke payee {id}. Transaksi
+// dipindahkan ke payee tujuan, nama dan alias sumber menjadi alias tujuan, lalu payee
+// sumber dihapus. Kategori bawaan sumber dipakai jika tujuan belum memilikinya.
+func MergePayees(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	targetID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid payee ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		SourceIDs []primitive.ObjectID `json:"source_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(request.SourceIDs) == 0 {
+		http.Error(w, "source_ids is required", http.StatusBadRequest)
+		return
+	}
+
+	target, err := findPayee(ledgerID, targetID)
+	if err != nil {
+		writePayeeError(w, err)
+		return
+	}
+
+	var sources []models.Payee
+	seen := make(map[primitive.ObjectID]bool)
+	for _, sourceID := range request.SourceIDs {
+		if sourceID == targetID {
+			http.Error(w, "A payee cannot be merged into itself", http.StatusBadRequest)
+			return
+		}
+		if seen[sourceID] {
+			continue
+		}
+		seen[sourceID] = true
+		source, err := findPayee(ledgerID, sourceID)
+		if err != nil {
+			writePayeeError(w, err)
+			return
+		}
+		sources = append(sources, source)
+	}
+
+	for _, source := range sources {
+		target.Aliases = append(target.Aliases, source.NormalizedName)
+		target.Aliases = append(target.Aliases, source.Aliases...)
+		if target.DefaultCategoryID == nil {
+			target.DefaultCategoryID = source.DefaultCategoryID
+		}
+	}
+	target.Aliases = normalizePayeeAliases(target.Aliases, target.NormalizedName)
+
+	releaseBalance, err := beginBalanceWrite(ledgerID)
+	if err != nil {
+		http.Error(w, "Error preparing balance snapshot", http.StatusInternalServerError)
+		return
+	}
+	defer releaseBalance()
+
+	relinked, err := mergePayeesAtomically(ledgerID, target, sources)
+	if err == errPayeeNotFound {
+		writePayeeError(w, err)
+		return
+	} else if err != nil {
+		http.Error(w, "Error merging payees", http.StatusInternalServerError)
+		return
+	}
+	for i := range relinked {
+		before := relinked[i]
+		after := before
+		after.PayeeID = &targetID
+		after.Version++
+		recordTransactionChange(actorID, ledgerID, "update", before.ID, &before, &after)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(target)
+}
+
+// GetPayeeReport menghitung total pemasukan dan pengeluaran per payee dalam rentang
+// tanggal, diurutkan dari pengeluaran terbesar. Transaksi tanpa payee dikelompokkan
+// dengan payee_id null.
+func GetPayeeReport(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	startDate, endDate, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"user_id":    ledgerID,
+			"deleted_at": nil,
+			"date":       bson.M{"$gte": startDate, "$lt": endDate},
+		}},
+		{"$group": bson.M{
+			"_id": "$payee_id",
+			"income": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$type", "income"}}, "$amount", 0,
+			}}},
+			"expense": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$type", "expense"}}, "$amount", 0,
+			}}},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$lookup": bson.M{
+			"from":         "payees",
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "payee",
+		}},
+		{"$project": bson.M{
+			"_id":        0,
+			"payee_id":   "$_id",
+			"payee_name": bson.M{"$first": "$payee.name"},
+			"income":     1,
+			"expense":    1,
+			"count":      1,
+		}},
+		{"$sort": bson.D{{Key: "expense", Value: -1}, {Key: "income", Value: -1}}},
+	}
+
+	cursor, err := database.TransactionCollection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		http.Error(w, "Error generating payee report", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	result := []struct {
+		PayeeID   *primitive.ObjectID `bson:"payee_id" json:"payee_id"`
+		PayeeName string              `bson:"payee_name" json:"payee_name"`
+		Income    float64             `bson:"income" json:"income"`
+		Expense   float64             `bson:"expense" json:"expense"`
+		Count     int                 `bson:"count" json:"count"`
+	}{}
+	if err = cursor.All(context.Background(), &result); err != nil {
+		http.Error(w, "Error decoding payee report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Fungsi helper untuk memvalidasi dan menormalisasi nama, alias, dan kategori bawaan payee
+func validatePayee(userID primitive.ObjectID, payee *models.Payee) error {
+	payee.Name = strings.TrimSpace(payee.Name)
+	payee.NormalizedName = normalizePayeeName(payee.Name)
+	if payee.NormalizedName == "" {
+		return errPayeeNameRequired
+	}
+	payee.Aliases = normalizePayeeAliases(payee.Aliases, payee.NormalizedName)
+
+	if payee.DefaultCategoryID != nil {
+		count, err := database.CategoryCollection.CountDocuments(context.Background(),
+			bson.M{"_id": *payee.DefaultCategoryID, "user_id": userID, "deleted_at": nil})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return errCategoryNotFound
+		}
+	}
+	return nil
+}
+
+func writePayeeError(w http.ResponseWriter, err error) {
+	switch err {
+	case errPayeeNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errPayeeExists:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errPayeeNameRequired, errCategoryNotFound:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Error processing payee", http.StatusInternalServerError)
+	}
+}
+
+func findPayee(userID, payeeID primitive.ObjectID) (models.Payee, error) {
+	var payee models.Payee
+	err := database.PayeeCollection.FindOne(context.Background(), bson.M{"_id": payeeID, "user_id": userID}).Decode(&payee)
+	if err == mongo.ErrNoDocuments {
+		return payee, errPayeeNotFound
+	}
+	return payee, err
+}
+
+func loadPayees(userID primitive.ObjectID) ([]models.Payee, error) {
+	cursor, err := database.PayeeCollection.Find(context.Background(), bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	payees := []models.Payee{}
+	err = cursor.All(context.Background(), &payees)
+	return payees, err
+}
+
+// Fungsi helper untuk memuat payee yang dipakai saat mengisi transaksi otomatis. Kategori
+// bawaan yang sudah dihapus diabaikan agar tidak menggagalkan pembuatan transaksi.
+func loadActivePayees(userID primitive.ObjectID) ([]models.Payee, error) {
+	payees, err := loadPayees(userID)
+	if err != nil || len(payees) == 0 {
+		return payees, err
+	}
+
+	var categoryIDs []primitive.ObjectID
+	for _, payee := range payees {
+		if payee.DefaultCategoryID != nil {
+			categoryIDs = append(categoryIDs, *payee.DefaultCategoryID)
+		}
+	}
+	active, err := activeCategoryIDs(userID, categoryIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range payees {
+		if payees[i].DefaultCategoryID != nil && !active[*payees[i].DefaultCategoryID] {
+			payees[i].DefaultCategoryID = nil
+		}
+	}
+	return payees, nil
+}
+
+// Fungsi helper untuk memindahkan transaksi (termasuk yang di tempat sampah) dari satu
+// payee ke payee lain, atau melepas tautannya jika to bernilai nil
+func relinkPayeeTransactions(actorID, userID, from primitive.ObjectID, to *primitive.ObjectID) error {
+	releaseBalance, err := beginBalanceWrite(userID)
+	if err != nil {
+		return err
+	}
+	defer releaseBalance()
+	transactions, err := movePayeeTransactions(context.Background(), userID, from, to)
+	if err != nil {
+		return err
+	}
+
+	for i := range transactions {
+		before := transactions[i]
+		after := before
+		after.PayeeID = to
+		after.Version++
+		recordTransactionChange(actorID, userID, "update", before.ID, &before, &after)
+	}
+	return nil
+}
+
+// Fungsi helper untuk memindahkan transaksi dari payee from ke payee to (nil untuk melepas
+// tautan) dan mengembalikan isi transaksi sebelum dipindahkan
+func movePayeeTransactions(ctx context.Context, userID, from primitive.ObjectID, to *primitive.ObjectID) ([]models.Transaction, error) {
+	filter := bson.M{"user_id": userID, "payee_id": from}
+	cursor, err := database.TransactionCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var transactions []models.Transaction
+	if err = cursor.All(ctx, &transactions); err != nil || len(transactions) == 0 {
+		return nil, err
+	}
+
+	update := bson.M{"$unset": bson.M{"payee_id": ""}, "$inc": bson.M{"version": 1}}
+	if to != nil {
+		update = bson.M{"$set": bson.M{"payee_id": *to}, "$inc": bson.M{"version": 1}}
+	}
+	if _, err := database.TransactionCollection.UpdateMany(ctx, filter, update); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// Fungsi helper untuk menggabungkan payee dalam satu multi-document transaction: alias
+// target diperbarui, transaksi setiap sumber dipindahkan ke target, lalu sumbernya dihapus.
+// Jika salah satu langkah gagal tidak ada yang tersimpan. Mengembalikan transaksi yang
+// dipindahkan agar audit dan snapshot saldo dicatat setelah commit.
+func mergePayeesAtomically(userID primitive.ObjectID, target models.Payee, sources []models.Payee) ([]models.Transaction, error) {
+	session, err := database.Client.StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(context.Background())
+
+	var relinked []models.Transaction
+	_, err = session.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+		// Callback bisa diulang oleh driver, jadi hasil percobaan sebelumnya dibuang
+		relinked = nil
+		result, err := database.PayeeCollection.UpdateOne(sessCtx,
+			bson.M{"_id": target.ID, "user_id": userID},
+			bson.M{"$set": bson.M{"aliases": target.Aliases, "default_category_id": target.DefaultCategoryID}})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, errPayeeNotFound
+		}
+
+		for _, source := range sources {
+			transactions, err := movePayeeTransactions(sessCtx, userID, source.ID, &target.ID)
+			if err != nil {
+				return nil, err
+			}
+			relinked = append(relinked, transactions...)
+
+			deleted, err := database.PayeeCollection.DeleteOne(sessCtx, bson.M{"_id": source.ID, "user_id": userID})
+			if err != nil {
+				return nil, err
+			}
+			if deleted.DeletedCount == 0 {
+				return nil, errPayeeNotFound
+			}
+		}
+		return nil, nil
+	})
+	return relinked, err
+}
+
+// Fungsi helper untuk menautkan transaksi ke payee yang nama atau aliasnya muncul di
+// deskripsi (alias terpanjang menang), lalu mengisi kategori bawaan payee jika transaksi
+// belum memiliki kategori maupun split
+func applyPayee(payees []models.Payee, transaction *models.Transaction) {
+	var matched *models.Payee
+	if transaction.PayeeID != nil {
+		for i := range payees {
+			if payees[i].ID == *transaction.PayeeID {
+				matched = &payees[i]
+				break
+			}
+		}
+	} else {
+		description := " " + normalizePayeeName(transaction.Description) + " "
+		longest := 0
+		for i := range payees {
+			for _, alias := range append([]string{payees[i].NormalizedName}, payees[i].Aliases...) {
+				if len(alias) > longest && strings.Contains(description, " "+alias+" ") {
+					matched, longest = &payees[i], len(alias)
+				}
+			}
+		}
+		if matched != nil {
+			transaction.PayeeID = &matched.ID
+		}
+	}
+
+	if matched != nil && matched.DefaultCategoryID != nil && transaction.CategoryID.IsZero() && len(transaction.Splits) == 0 {
+		transaction.CategoryID = *matched.DefaultCategoryID
+	}
+}
+
+// Fungsi helper untuk memastikan payee transaksi milik user
+func checkTransactionPayee(userID primitive.ObjectID, payeeID *primitive.ObjectID) error {
+	if payeeID == nil {
+		return nil
+	}
+	_, err := findPayee(userID, *payeeID)
+	return err
+}
+
+// normalizePayeeName mengubah nama mentah menjadi huruf kecil tanpa angka dan tanda baca,
+// misalnya "GRAB*FOOD 123" menjadi "grab food"
+func normalizePayeeName(name string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}), " ")
+}
+
+func normalizePayeeAliases(aliases []string, normalizedName string) []string {
+	var normalized []string
+	seen := map[string]bool{normalizedName: true}
+	for _, alias := range aliases {
+		alias = normalizePayeeName(alias)
+		if alias == "" || seen[alias] {
+			continue
+		}
+		seen[alias] = true
+		normalized = append(normalized, alias)
+	}
+	return normalized
+}
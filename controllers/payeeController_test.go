@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"finance-app/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNormalizePayeeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"GrabFood", "grabfood"},
+		{"GRAB*FOOD 123", "grab food"},
+		{"  Indomaret - Jl. Sudirman #12 ", "indomaret jl sudirman"},
+		{"12345", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizePayeeName(tt.name); got != tt.want {
+			t.Errorf("normalizePayeeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizePayeeAliasesDropsDuplicates(t *testing.T) {
+	got := normalizePayeeAliases([]string{"GRAB*FOOD", "grab food", "GrabFood", "", "Grab-Food 99"}, "grabfood")
+	if want := []string{"grab food"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizePayeeAliases = %v, want %v", got, want)
+	}
+}
+
+func TestApplyPayee(t *testing.T) {
+	food := primitive.NewObjectID()
+	grabFood := models.Payee{ID: primitive.NewObjectID(), Name: "GrabFood", NormalizedName: "grabfood", Aliases: []string{"grab food"}, DefaultCategoryID: &food}
+	grab := models.Payee{ID: primitive.NewObjectID(), Name: "Grab", NormalizedName: "grab"}
+	indomaret := models.Payee{ID: primitive.NewObjectID(), Name: "Indomaret", NormalizedName: "indomaret"}
+	payees := []models.Payee{grab, grabFood, indomaret}
+
+	other := primitive.NewObjectID()
+	tests := []struct {
+		name         string
+		transaction  models.Transaction
+		wantPayee    *primitive.ObjectID
+		wantCategory primitive.ObjectID
+	}{
+		{
+			name:         "alias matches merchant code",
+			transaction:  models.Transaction{Description: "GRAB*FOOD 123"},
+			wantPayee:    &grabFood.ID,
+			wantCategory: food,
+		},
+		{
+			name:         "longest alias wins over shorter name",
+			transaction:  models.Transaction{Description: "grab food jakarta", CategoryID: other},
+			wantPayee:    &grabFood.ID,
+			wantCategory: other,
+		},
+		{
+			name:        "whole words only",
+			transaction: models.Transaction{Description: "Grabbed lunch"},
+		},
+		{
+			name:        "plain name match without default category",
+			transaction: models.Transaction{Description: "Indomaret Sudirman"},
+			wantPayee:   &indomaret.ID,
+		},
+		{
+			name:         "explicit payee keeps link and fills default category",
+			transaction:  models.Transaction{Description: "Indomaret", PayeeID: &grabFood.ID},
+			wantPayee:    &grabFood.ID,
+			wantCategory: food,
+		},
+		{
+			name:        "split transaction keeps empty category",
+			transaction: models.Transaction{Description: "GRAB*FOOD", Splits: []models.TransactionSplit{{Amount: 1}}},
+			wantPayee:   &grabFood.ID,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction := tt.transaction
+			applyPayee(payees, &transaction)
+			if !reflect.DeepEqual(transaction.PayeeID, tt.wantPayee) {
+				t.Errorf("payee = %v, want %v", transaction.PayeeID, tt.wantPayee)
+			}
+			if transaction.CategoryID != tt.wantCategory {
+				t.Errorf("category = %v, want %v", transaction.CategoryID, tt.wantCategory)
+			}
+		})
+	}
+}
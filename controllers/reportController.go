@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"finance-app/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetCategoryReport menghitung total per kategori dalam rentang tanggal.
+// Transaksi split dihitung per baris pada kategorinya masing-masing.
+func GetCategoryReport(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	startDate, endDate, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"user_id":    ledgerID,
+			"deleted_at": nil,
+			"date":       bson.M{"$gte": startDate, "$lt": endDate},
+		}},
+	}
+	pipeline = append(pipeline, database.SplitLineStages()...)
+	pipeline = append(pipeline,
+		bson.M{"$group": bson.M{
+			"_id":   bson.M{"category_id": "$category_id", "type": "$type"},
+			"total": bson.M{"$sum": "$amount"},
+			"count": bson.M{"$sum": 1},
+		}},
+		bson.M{"$lookup": bson.M{
+			"from":         "categories",
+			"localField":   "_id.category_id",
+			"foreignField": "_id",
+			"as":           "category",
+		}},
+		bson.M{"$project": bson.M{
+			"_id":           0,
+			"category_id":   "$_id.category_id",
+			"type":          "$_id.type",
+			"category_name": bson.M{"$first": "$category.name"},
+			"total":         1,
+			"count":         1,
+		}},
+		bson.M{"$sort": bson.D{{Key: "type", Value: 1}, {Key: "total", Value: -1}}},
+	)
+
+	cursor, err := database.TransactionCollection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		http.Error(w, "Error generating category report", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	var result []struct {
+		CategoryID   primitive.ObjectID `bson:"category_id" json:"category_id"`
+		CategoryName string             `bson:"category_name" json:"category_name"`
+		Type         string             `bson:"type" json:"type"`
+		Total        float64            `bson:"total" json:"total"`
+		Count        int                `bson:"count" json:"count"`
+	}
+	if err = cursor.All(context.Background(), &result); err != nil {
+		http.Error(w, "Error decoding category report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
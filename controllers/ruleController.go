@@ -0,0 +1,509 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"finance-app/database"
+	"finance-app/models"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errRuleNotFound      = errors.New("Rule not found")
+	errInvalidRuleRegex  = errors.New("Invalid description_regex")
+	errInvalidRuleAmount = errors.New("min_amount must not be greater than max_amount")
+	errEmptyRule         = errors.New("Rule must have at least one condition and a category_id or tags")
+)
+
+const (
+	// Jumlah contoh transaksi yang dikembalikan endpoint uji aturan
+	ruleTestSampleSize = 20
+	// Jumlah transaksi yang diproses per halaman saat aturan diterapkan ulang
+	applyRulesPageSize = 500
+)
+
+func CreateRule(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	var rule models.CategoryRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rule.ID = primitive.NewObjectID()
+	rule.UserID = ledgerID
+	rule.CreatedAt = time.Now()
+
+	if err := validateRule(ledgerID, &rule); err != nil {
+		writeRuleValidationError(w, err)
+		return
+	}
+
+	if _, err := database.CategoryRuleCollection.InsertOne(context.Background(), rule); err != nil {
+		http.Error(w, "Error creating rule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+// GetRules mengembalikan aturan milik user sesuai urutan evaluasinya
+func GetRules(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	rules, err := findRules(ledgerID)
+	if err != nil {
+		http.Error(w, "Error fetching rules", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+func UpdateRule(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	ruleID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return
+	}
+
+	var existing models.CategoryRule
+	err = database.CategoryRuleCollection.FindOne(context.Background(), bson.M{"_id": ruleID, "user_id": ledgerID}).Decode(&existing)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, errRuleNotFound.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, "Error finding rule", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var rule models.CategoryRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rule.ID = ruleID
+	rule.UserID = ledgerID
+	rule.CreatedAt = existing.CreatedAt
+
+	if err := validateRule(ledgerID, &rule); err != nil {
+		writeRuleValidationError(w, err)
+		return
+	}
+
+	if _, err := database.CategoryRuleCollection.ReplaceOne(context.Background(), bson.M{"_id": ruleID, "user_id": ledgerID}, rule); err != nil {
+		http.Error(w, "Error updating rule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+func DeleteRule(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	ruleID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := database.CategoryRuleCollection.DeleteOne(context.Background(), bson.M{"_id": ruleID, "user_id": ledgerID})
+	if err != nil {
+		http.Error(w, "Error deleting rule", http.StatusInternalServerError)
+		return
+	}
+	if result.DeletedCount == 0 {
+		http.Error(w, errRuleNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Rule deleted successfully"})
+}
+
+// TestRule menguji aturan tanpa menyimpannya. Jika body berisi transaction, respons
+// menyatakan apakah transaksi itu cocok dan hasil kategori serta tagnya. Jika tidak,
+// respons berisi jumlah dan contoh transaksi lama yang cocok dengan aturan.
+func TestRule(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	var body struct {
+		Rule        models.CategoryRule `json:"rule"`
+		Transaction *models.Transaction `json:"transaction"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateRule(ledgerID, &body.Rule); err != nil {
+		writeRuleValidationError(w, err)
+		return
+	}
+
+	rule, err := compileRule(body.Rule)
+	if err != nil {
+		writeRuleValidationError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if body.Transaction != nil {
+		transaction := *body.Transaction
+		matches := ruleMatches(rule, transaction)
+		if matches {
+			applyRuleResult(body.Rule, &transaction, true)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"matches":     matches,
+			"category_id": transaction.CategoryID,
+			"tags":        transaction.Tags,
+		})
+		return
+	}
+
+	cursor, err := database.TransactionCollection.Find(context.Background(),
+		bson.M{"user_id": ledgerID, "deleted_at": nil},
+		options.Find().SetSort(bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		http.Error(w, "Error fetching transactions", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	matched := 0
+	samples := []models.Transaction{}
+	for cursor.Next(context.Background()) {
+		var transaction models.Transaction
+		if err := cursor.Decode(&transaction); err != nil {
+			http.Error(w, "Error decoding transactions", http.StatusInternalServerError)
+			return
+		}
+		if !ruleMatches(rule, transaction) {
+			continue
+		}
+		matched++
+		if len(samples) < ruleTestSampleSize {
+			samples = append(samples, transaction)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		http.Error(w, "Error fetching transactions", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"matched_count": matched,
+		"transactions":  samples,
+	})
+}
+
+// ApplyRules menerapkan ulang aturan ke transaksi lama, opsional dalam rentang
+// ?start_date=&end_date=. Transaksi split tidak diubah kategorinya, hanya tagnya.
+// Kategori transaksi diganti dengan kategori aturan pertama yang cocok.
+func ApplyRules(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	filter := bson.M{"user_id": ledgerID, "deleted_at": nil}
+	if r.URL.Query().Get("start_date") != "" || r.URL.Query().Get("end_date") != "" {
+		startDate, endDate, err := parseDateRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter["date"] = bson.M{"$gte": startDate, "$lt": endDate}
+	}
+
+	rules, err := loadActiveRules(ledgerID)
+	if err != nil {
+		http.Error(w, "Error fetching rules", http.StatusInternalServerError)
+		return
+	}
+
+	// Transaksi diproses per halaman agar penulisan snapshot saldo hanya ditahan selama
+	// satu halaman, bukan selama seluruh ledger
+	matched, updated := 0, 0
+	lastID := primitive.NilObjectID
+	for {
+		filter["_id"] = bson.M{"$gt": lastID}
+		opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(applyRulesPageSize)
+		cursor, err := database.TransactionCollection.Find(context.Background(), filter, opts)
+		if err != nil {
+			http.Error(w, "Error fetching transactions", http.StatusInternalServerError)
+			return
+		}
+		var transactions []models.Transaction
+		if err = cursor.All(context.Background(), &transactions); err != nil {
+			http.Error(w, "Error fetching transactions", http.StatusInternalServerError)
+			return
+		}
+		if len(transactions) == 0 {
+			break
+		}
+
+		pageMatched, pageUpdated, err := applyRulesToPage(actorID, ledgerID, rules, transactions)
+		matched += pageMatched
+		updated += pageUpdated
+		if err != nil {
+			http.Error(w, "Error applying rules", http.StatusInternalServerError)
+			return
+		}
+		if len(transactions) < applyRulesPageSize {
+			break
+		}
+		lastID = transactions[len(transactions)-1].ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"matched": matched, "updated": updated})
+}
+
+// Fungsi helper untuk menerapkan aturan ke satu halaman transaksi selama menahan
+// penulisan snapshot saldo
+func applyRulesToPage(actorID, userID primitive.ObjectID, rules []activeRule, transactions []models.Transaction) (int, int, error) {
+	releaseBalance, err := beginBalanceWrite(userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer releaseBalance()
+
+	matched, updated := 0, 0
+	for _, before := range transactions {
+		after := before
+		after.Tags = append([]string(nil), before.Tags...)
+		if !applyRules(rules, &after, true) {
+			continue
+		}
+		matched++
+		if after.CategoryID == before.CategoryID && equalTags(after.Tags, before.Tags) {
+			continue
+		}
+
+		// Versi dicek agar perubahan dari request lain di antara baca dan tulis tidak tertimpa
+		result, err := database.TransactionCollection.UpdateOne(context.Background(),
+			bson.M{"_id": before.ID, "user_id": userID, "deleted_at": nil, "version": versionFilter(before.Version)},
+			bson.M{
+				"$set": bson.M{"category_id": after.CategoryID, "tags": after.Tags},
+				"$inc": bson.M{"version": 1},
+			})
+		if err != nil {
+			return matched, updated, err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		after.Version = before.Version + 1
+		recordTransactionChange(actorID, userID, "update", before.ID, &before, &after)
+		updated++
+	}
+	return matched, updated, nil
+}
+
+// Fungsi helper untuk memvalidasi aturan dan menyamakan tipenya dengan tipe kategori
+func validateRule(userID primitive.ObjectID, rule *models.CategoryRule) error {
+	rule.Tags = normalizeTags(rule.Tags)
+	rule.DescriptionContains = strings.TrimSpace(rule.DescriptionContains)
+
+	if rule.DescriptionContains == "" && rule.DescriptionRegex == "" && rule.MinAmount == nil && rule.MaxAmount == nil && rule.Type == "" {
+		return errEmptyRule
+	}
+	if rule.CategoryID.IsZero() && len(rule.Tags) == 0 {
+		return errEmptyRule
+	}
+	if rule.Type != "" && rule.Type != "income" && rule.Type != "expense" {
+		return errInvalidTransactionType
+	}
+	if _, err := compileRule(*rule); err != nil {
+		return err
+	}
+	if rule.MinAmount != nil && rule.MaxAmount != nil && *rule.MinAmount > *rule.MaxAmount {
+		return errInvalidRuleAmount
+	}
+
+	// Aturan dengan kategori hanya berlaku untuk transaksi bertipe sama dengan kategorinya
+	if !rule.CategoryID.IsZero() {
+		var category models.Category
+		err := database.CategoryCollection.FindOne(context.Background(), bson.M{"_id": rule.CategoryID, "user_id": userID, "deleted_at": nil}).Decode(&category)
+		if err == mongo.ErrNoDocuments {
+			return errCategoryNotFound
+		} else if err != nil {
+			return err
+		}
+		if rule.Type == "" {
+			rule.Type = category.Type
+		} else if rule.Type != category.Type {
+			return errCategoryTypeMismatch
+		}
+	}
+	return nil
+}
+
+func writeRuleValidationError(w http.ResponseWriter, err error) {
+	switch err {
+	case errEmptyRule, errInvalidTransactionType, errInvalidRuleRegex, errInvalidRuleAmount, errCategoryNotFound, errCategoryTypeMismatch:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Error validating rule", http.StatusInternalServerError)
+	}
+}
+
+func findRules(userID primitive.ObjectID) ([]models.CategoryRule, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "priority", Value: 1}, {Key: "created_at", Value: 1}})
+	cursor, err := database.CategoryRuleCollection.Find(context.Background(), bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	rules := []models.CategoryRule{}
+	err = cursor.All(context.Background(), &rules)
+	return rules, err
+}
+
+// activeRule adalah aturan yang siap dievaluasi beserta regex deskripsinya yang sudah
+// dikompilasi, agar regex tidak dikompilasi ulang untuk setiap transaksi
+type activeRule struct {
+	models.CategoryRule
+	pattern *regexp.Regexp
+}
+
+// Fungsi helper untuk mengompilasi regex deskripsi aturan (tanpa membedakan huruf besar/kecil)
+func compileRule(rule models.CategoryRule) (activeRule, error) {
+	compiled := activeRule{CategoryRule: rule}
+	if rule.DescriptionRegex != "" {
+		pattern, err := regexp.Compile("(?i)" + rule.DescriptionRegex)
+		if err != nil {
+			return compiled, errInvalidRuleRegex
+		}
+		compiled.pattern = pattern
+	}
+	return compiled, nil
+}
+
+// Fungsi helper untuk memuat aturan yang siap dievaluasi. Aturan yang kategorinya sudah
+// dihapus atau regexnya tidak valid dilewati agar tidak menggagalkan pembuatan transaksi.
+func loadActiveRules(userID primitive.ObjectID) ([]activeRule, error) {
+	rules, err := findRules(userID)
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+
+	var categoryIDs []primitive.ObjectID
+	for _, rule := range rules {
+		if !rule.CategoryID.IsZero() {
+			categoryIDs = append(categoryIDs, rule.CategoryID)
+		}
+	}
+	active, err := activeCategoryIDs(userID, categoryIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	usable := make([]activeRule, 0, len(rules))
+	for _, rule := range rules {
+		if !rule.CategoryID.IsZero() && !active[rule.CategoryID] {
+			continue
+		}
+		compiled, err := compileRule(rule)
+		if err != nil {
+			continue
+		}
+		usable = append(usable, compiled)
+	}
+	return usable, nil
+}
+
+// Fungsi helper untuk mengambil ID kategori yang masih aktif milik user dari daftar ids
+func activeCategoryIDs(userID primitive.ObjectID, ids []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	active := make(map[primitive.ObjectID]bool)
+	if len(ids) == 0 {
+		return active, nil
+	}
+	found, err := database.CategoryCollection.Distinct(context.Background(), "_id",
+		bson.M{"_id": bson.M{"$in": ids}, "user_id": userID, "deleted_at": nil})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range found {
+		if id, ok := id.(primitive.ObjectID); ok {
+			active[id] = true
+		}
+	}
+	return active, nil
+}
+
+// Fungsi helper untuk menerapkan aturan pertama yang cocok. overwrite menentukan apakah
+// kategori yang sudah ada boleh diganti. Mengembalikan true jika ada aturan yang cocok.
+func applyRules(rules []activeRule, transaction *models.Transaction, overwrite bool) bool {
+	for _, rule := range rules {
+		if ruleMatches(rule, *transaction) {
+			applyRuleResult(rule.CategoryRule, transaction, overwrite)
+			return true
+		}
+	}
+	return false
+}
+
+func applyRuleResult(rule models.CategoryRule, transaction *models.Transaction, overwrite bool) {
+	if !rule.CategoryID.IsZero() && len(transaction.Splits) == 0 && (overwrite || transaction.CategoryID.IsZero()) {
+		transaction.CategoryID = rule.CategoryID
+	}
+	transaction.Tags = normalizeTags(append(transaction.Tags, rule.Tags...))
+}
+
+func ruleMatches(rule activeRule, transaction models.Transaction) bool {
+	if rule.Type != "" && rule.Type != transaction.Type {
+		return false
+	}
+	if rule.MinAmount != nil && transaction.Amount < *rule.MinAmount {
+		return false
+	}
+	if rule.MaxAmount != nil && transaction.Amount > *rule.MaxAmount {
+		return false
+	}
+	if rule.DescriptionContains != "" &&
+		!strings.Contains(strings.ToLower(transaction.Description), strings.ToLower(rule.DescriptionContains)) {
+		return false
+	}
+	if rule.pattern != nil && !rule.pattern.MatchString(transaction.Description) {
+		return false
+	}
+	return true
+}
+
+func equalTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
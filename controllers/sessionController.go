@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"finance-app/database"
+	"finance-app/models"
+	"finance-app/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errInvalidRefreshToken = errors.New("Invalid or expired refresh token")
+
+// RefreshSession menukar refresh token dengan access token dan refresh token baru. Refresh
+// token lama tidak bisa dipakai lagi; jika dipakai ulang (misalnya karena dicuri), seluruh
+// sesi dicabut.
+func RefreshSession(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.RefreshToken == "" {
+		http.Error(w, errInvalidRefreshToken.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var stored models.RefreshToken
+	err := database.RefreshTokenCollection.FindOne(context.Background(), bson.M{"token_hash": utils.HashToken(request.RefreshToken)}).Decode(&stored)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, errInvalidRefreshToken.Error(), http.StatusUnauthorized)
+		} else {
+			http.Error(w, "Error finding refresh token", http.StatusInternalServerError)
+		}
+		return
+	}
+	now := time.Now()
+	if stored.RevokedAt != nil || now.After(stored.ExpiresAt) {
+		http.Error(w, errInvalidRefreshToken.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Tandai token sudah dipakai. Jika gagal, token sudah pernah dirotasi (termasuk oleh
+	// request lain yang bersamaan) dan dianggap dipakai ulang.
+	result, err := database.RefreshTokenCollection.UpdateOne(context.Background(),
+		bson.M{"_id": stored.ID, "used_at": nil, "revoked_at": nil},
+		bson.M{"$set": bson.M{"used_at": now}})
+	if err != nil {
+		http.Error(w, "Error rotating refresh token", http.StatusInternalServerError)
+		return
+	}
+	if result.ModifiedCount == 0 {
+		log.Printf("Refresh token reuse detected for user %s, revoking session %s", stored.UserID.Hex(), stored.FamilyID.Hex())
+		if err := revokeSession(stored.UserID, stored.FamilyID); err != nil {
+			log.Printf("Error revoking session %s: %v", stored.FamilyID.Hex(), err)
+		}
+		http.Error(w, errInvalidRefreshToken.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	session, err := issueSession(stored.UserID, stored.FamilyID)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// Logout mencabut sesi access token yang dipakai beserta refresh token-nya
+func Logout(w http.ResponseWriter, r *http.Request) {
+	// Ambil user ID dan sesi dari context
+	userID := r.Context().Value("user_id").(primitive.ObjectID)
+	sessionID := r.Context().Value("session_id").(primitive.ObjectID)
+
+	if err := revokeSession(userID, sessionID); err != nil {
+		http.Error(w, "Error logging out", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
+}
+
+// LogoutAll mencabut semua sesi user di semua perangkat
+func LogoutAll(w http.ResponseWriter, r *http.Request) {
+	// Ambil user ID dari context
+	userID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	if err := revokeAllSessions(userID); err != nil {
+		http.Error(w, "Error logging out", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out from all sessions successfully"})
+}
+
+// Fungsi helper untuk menerbitkan access token dan refresh token baru di sesi familyID
+func issueSession(userID, familyID primitive.ObjectID) (map[string]interface{}, error) {
+	// Versi dibaca sebelum token diterbitkan agar logout-all yang terjadi sesudahnya tetap
+	// menolak access token ini
+	var user models.User
+	err := database.UserCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, hash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	_, err = database.RefreshTokenCollection.InsertOne(context.Background(), models.RefreshToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(utils.RefreshTokenTTL()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := utils.GenerateToken(userID, familyID, user.TokenVersion)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int64(utils.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// Fungsi helper untuk mencabut satu sesi: semua refresh token di keluarganya dicabut dan
+// sesi dimasukkan ke daftar pencabutan agar access token-nya ikut ditolak. Entri pencabutan
+// disimpan selama access token terakhir sesi itu masih bisa diterima.
+func revokeSession(userID, familyID primitive.ObjectID) error {
+	now := time.Now()
+	_, err := database.RefreshTokenCollection.UpdateMany(context.Background(),
+		bson.M{"user_id": userID, "family_id": familyID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": now}})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.RevokedSessionCollection.UpdateOne(context.Background(),
+		bson.M{"_id": familyID},
+		bson.M{"$setOnInsert": bson.M{
+			"user_id":    userID,
+			"revoked_at": now,
+			"expires_at": now.Add(utils.AccessTokenMaxAge()),
+		}},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+// Fungsi helper untuk mencabut semua sesi user. Versi token user dinaikkan sehingga semua
+// access token yang sudah diterbitkan ditolak oleh AuthMiddleware.
+func revokeAllSessions(userID primitive.ObjectID) error {
+	now := time.Now()
+	_, err := database.RefreshTokenCollection.UpdateMany(context.Background(),
+		bson.M{"user_id": userID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": now}})
+	if err != nil {
+		return err
+	}
+	_, err = database.UserCollection.UpdateOne(context.Background(),
+		bson.M{"_id": userID},
+		bson.M{"$inc": bson.M{"token_version": 1}})
+	return err
+}
+
+// Fungsi helper untuk mencabut semua sesi user kecuali sesi keepFamilyID. Versi token user
+// dinaikkan dan dikembalikan agar sesi yang dipertahankan bisa diberi access token baru.
+func revokeOtherSessions(userID, keepFamilyID primitive.ObjectID) (int64, error) {
+	_, err := database.RefreshTokenCollection.UpdateMany(context.Background(),
+		bson.M{"user_id": userID, "family_id": bson.M{"$ne": keepFamilyID}, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+	var user models.User
+	err = database.UserCollection.FindOneAndUpdate(context.Background(),
+		bson.M{"_id": userID},
+		bson.M{"$inc": bson.M{"token_version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+	return user.TokenVersion, err
+}
@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"finance-app/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Batas jumlah bucket per seri agar rentang yang terlalu panjang tidak membebani server
+const maxTimeSeriesBuckets = 1000
+
+type timeSeriesPoint struct {
+	Bucket  string  `json:"bucket"` // Awal bucket dalam format YYYY-MM-DD di zona waktu laporan
+	Income  float64 `json:"income"`
+	Expense float64 `json:"expense"`
+	Net     float64 `json:"net"`
+}
+
+type categorySeries struct {
+	CategoryID   primitive.ObjectID `json:"category_id"`
+	CategoryName string             `json:"category_name"`
+	Points       []timeSeriesPoint  `json:"points"`
+}
+
+// timeSeriesInterval menentukan awal bucket dan jarak antar bucket untuk satu interval.
+// Minggu dimulai hari Senin, sama dengan startOfWeek pada $dateTrunc.
+type timeSeriesInterval struct {
+	truncate func(t time.Time) time.Time
+	next     func(t time.Time) time.Time
+	span     func(to time.Time) time.Time // Awal rentang default jika from kosong
+}
+
+var timeSeriesIntervals = map[string]timeSeriesInterval{
+	"day": {
+		truncate: func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()) },
+		next:     func(t time.Time) time.Time { return t.AddDate(0, 0, 1) },
+		span:     func(to time.Time) time.Time { return to.AddDate(0, 0, -29) },
+	},
+	"week": {
+		truncate: func(t time.Time) time.Time {
+			day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+			return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		},
+		next: func(t time.Time) time.Time { return t.AddDate(0, 0, 7) },
+		span: func(to time.Time) time.Time { return to.AddDate(0, 0, -7*11) },
+	},
+	"month": {
+		truncate: func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()) },
+		next:     func(t time.Time) time.Time { return t.AddDate(0, 1, 0) },
+		span:     func(to time.Time) time.Time { return to.AddDate(0, -11, 0) },
+	},
+	"year": {
+		truncate: func(t time.Time) time.Time { return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location()) },
+		next:     func(t time.Time) time.Time { return t.AddDate(1, 0, 0) },
+		span:     func(to time.Time) time.Time { return to.AddDate(-4, 0, 0) },
+	},
+}
+
+// GetTimeSeries mengembalikan seri pemasukan, pengeluaran, dan selisih per bucket waktu
+// (?interval=day|week|month|year, default month) dalam rentang ?from=&to= (YYYY-MM-DD).
+// ?group_by=category memecah seri per kategori, dengan transaksi split dihitung per baris.
+// Bucket tanpa transaksi tetap dikembalikan dengan nilai nol.
+func GetTimeSeries(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	intervalName := r.URL.Query().Get("interval")
+	if intervalName == "" {
+		intervalName = "month"
+	}
+	interval, ok := timeSeriesIntervals[intervalName]
+	if !ok {
+		http.Error(w, "Invalid interval. Must be 'day', 'week', 'month' or 'year'", http.StatusBadRequest)
+		return
+	}
+
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy != "" && groupBy != "category" {
+		http.Error(w, "Invalid group_by. Must be 'category'", http.StatusBadRequest)
+		return
+	}
+
+	location, err := userLocation(r)
+	if err == errInvalidTimezone {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Error loading user timezone", http.StatusInternalServerError)
+		return
+	}
+
+	// Rentang dibaca di zona waktu laporan; to bersifat inklusif sampai akhir hari
+	now := time.Now().In(location)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		if to, err = time.ParseInLocation("2006-01-02", toStr, location); err != nil {
+			http.Error(w, "Invalid to date. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	from := interval.truncate(interval.span(to))
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		if from, err = time.ParseInLocation("2006-01-02", fromStr, location); err != nil {
+			http.Error(w, "Invalid from date. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	end := to.AddDate(0, 0, 1)
+	if !from.Before(end) {
+		http.Error(w, "Invalid date range. from must not be after to", http.StatusBadRequest)
+		return
+	}
+
+	var buckets []time.Time
+	for bucket := interval.truncate(from); bucket.Before(end); bucket = interval.next(bucket) {
+		if len(buckets) == maxTimeSeriesBuckets {
+			http.Error(w, "Date range has too many buckets for this interval", http.StatusBadRequest)
+			return
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"user_id":    ledgerID,
+			"deleted_at": nil,
+			"date":       bson.M{"$gte": from, "$lt": end},
+		}},
+	}
+	groupID := bson.M{
+		"bucket": bson.M{"$dateTrunc": bson.M{
+			"date":        "$date",
+			"unit":        intervalName,
+			"timezone":    location.String(),
+			"startOfWeek": "monday",
+		}},
+		"type": "$type",
+	}
+	if groupBy == "category" {
+		pipeline = append(pipeline, database.SplitLineStages()...)
+		groupID["category_id"] = "$category_id"
+	}
+	pipeline = append(pipeline, bson.M{"$group": bson.M{
+		"_id":   groupID,
+		"total": bson.M{"$sum": "$amount"},
+	}})
+
+	cursor, err := database.TransactionCollection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		http.Error(w, "Error generating time series", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	var rows []struct {
+		ID struct {
+			Bucket     time.Time          `bson:"bucket"`
+			Type       string             `bson:"type"`
+			CategoryID primitive.ObjectID `bson:"category_id"`
+		} `bson:"_id"`
+		Total float64 `bson:"total"`
+	}
+	if err = cursor.All(context.Background(), &rows); err != nil {
+		http.Error(w, "Error decoding time series", http.StatusInternalServerError)
+		return
+	}
+
+	// Isi bucket yang kosong dengan nol, lalu tambahkan hasil agregasi ke bucket-nya
+	index := make(map[int64]int, len(buckets))
+	for i, bucket := range buckets {
+		index[bucket.Unix()] = i
+	}
+	series := make(map[primitive.ObjectID][]timeSeriesPoint)
+	for _, row := range rows {
+		points, ok := series[row.ID.CategoryID]
+		if !ok {
+			points = emptyTimeSeries(buckets)
+			series[row.ID.CategoryID] = points
+		}
+		i, ok := index[row.ID.Bucket.Unix()]
+		if !ok {
+			continue
+		}
+		if row.ID.Type == "income" {
+			points[i].Income += row.Total
+			points[i].Net += row.Total
+		} else {
+			points[i].Expense += row.Total
+			points[i].Net -= row.Total
+		}
+	}
+
+	response := map[string]interface{}{
+		"interval": intervalName,
+		"timezone": location.String(),
+		"from":     from.Format("2006-01-02"),
+		"to":       to.Format("2006-01-02"),
+	}
+	if groupBy == "category" {
+		grouped, err := categoryTimeSeries(ledgerID, series)
+		if err != nil {
+			http.Error(w, "Error fetching categories", http.StatusInternalServerError)
+			return
+		}
+		response["series"] = grouped
+	} else if points, ok := series[primitive.NilObjectID]; ok {
+		response["series"] = points
+	} else {
+		response["series"] = emptyTimeSeries(buckets)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func emptyTimeSeries(buckets []time.Time) []timeSeriesPoint {
+	points := make([]timeSeriesPoint, len(buckets))
+	for i, bucket := range buckets {
+		points[i].Bucket = bucket.Format("2006-01-02")
+	}
+	return points
+}
+
+// Fungsi helper untuk melengkapi seri per kategori dengan nama kategori, diurutkan menurut nama
+func categoryTimeSeries(userID primitive.ObjectID, series map[primitive.ObjectID][]timeSeriesPoint) ([]categorySeries, error) {
+	ids := make([]primitive.ObjectID, 0, len(series))
+	for id := range series {
+		ids = append(ids, id)
+	}
+
+	cursor, err := database.CategoryCollection.Find(context.Background(), bson.M{"_id": bson.M{"$in": ids}, "user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	names := make(map[primitive.ObjectID]string)
+	for cursor.Next(context.Background()) {
+		var category struct {
+			ID   primitive.ObjectID `bson:"_id"`
+			Name string             `bson:"name"`
+		}
+		if err := cursor.Decode(&category); err != nil {
+			return nil, err
+		}
+		names[category.ID] = category.Name
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]categorySeries, 0, len(series))
+	for id, points := range series {
+		result = append(result, categorySeries{CategoryID: id, CategoryName: names[id], Points: points})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CategoryName < result[j].CategoryName })
+	return result, nil
+}
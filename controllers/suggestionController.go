@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"finance-app/classifier"
+	"finance-app/database"
+	"finance-app/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Jumlah transaksi terbaru yang dipakai untuk melatih model saran kategori
+	suggestionTrainingLimit = 5000
+	// Model dilatih ulang setelah masa ini meskipun tidak ada transaksi yang berubah
+	suggestionModelTTL = 15 * time.Minute
+	maxSuggestions     = 3
+)
+
+type categorySuggestion struct {
+	CategoryID   primitive.ObjectID `json:"category_id"`
+	CategoryName string             `json:"category_name"`
+	Type         string             `json:"type"`
+	Confidence   float64            `json:"confidence"`
+}
+
+type importPreviewRow struct {
+	Index       int                  `json:"index"`
+	Transaction models.Transaction   `json:"transaction"`
+	RuleApplied bool                 `json:"rule_applied"` // Kategori atau tag diisi oleh aturan otomatis
+	Suggestions []categorySuggestion `json:"suggestions"`
+}
+
+type cachedSuggestionModel struct {
+	model     *classifier.NaiveBayes
+	trainedAt time.Time
+}
+
+// Model per user disimpan di memori dan dibuang setiap kali transaksi user berubah. Entri
+// yang lebih tua dari suggestionModelTTL dihapus berkala agar map tidak terus bertambah.
+var suggestionModels = struct {
+	sync.Mutex
+	byUser  map[primitive.ObjectID]cachedSuggestionModel
+	sweptAt time.Time
+}{byUser: make(map[primitive.ObjectID]cachedSuggestionModel)}
+
+// SuggestCategories menyarankan kategori untuk ?description= (wajib) dan ?amount=,
+// opsional dibatasi ?type=, berdasarkan riwayat transaksi user sendiri
+func SuggestCategories(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	description := strings.TrimSpace(r.URL.Query().Get("description"))
+	if description == "" {
+		http.Error(w, "description is required", http.StatusBadRequest)
+		return
+	}
+	var amount float64
+	if amountStr := r.URL.Query().Get("amount"); amountStr != "" {
+		var err error
+		if amount, err = strconv.ParseFloat(amountStr, 64); err != nil || amount < 0 {
+			http.Error(w, "Invalid amount", http.StatusBadRequest)
+			return
+		}
+	}
+	transactionType := r.URL.Query().Get("type")
+	if transactionType != "" && transactionType != "income" && transactionType != "expense" {
+		http.Error(w, errInvalidTransactionType.Error(), http.StatusBadRequest)
+		return
+	}
+
+	suggester, err := newCategorySuggester(ledgerID)
+	if err != nil {
+		http.Error(w, "Error building category suggestions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggester.suggest(description, amount, transactionType))
+}
+
+// PreviewImport menampilkan hasil impor tanpa menyimpan apa pun: aturan otomatis dan
+// payee diterapkan ke setiap baris dan saran kategori beserta skor keyakinannya disertakan.
+// Baris yang sudah diperiksa dapat disimpan dengan POST /transactions/import.
+func PreviewImport(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	var request struct {
+		Transactions []models.Transaction `json:"transactions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(request.Transactions) == 0 || len(request.Transactions) > maxBatchOperations {
+		http.Error(w, fmt.Sprintf("transactions must contain between 1 and %d items", maxBatchOperations), http.StatusBadRequest)
+		return
+	}
+
+	rules, err := loadActiveRules(ledgerID)
+	if err != nil {
+		http.Error(w, "Error fetching rules", http.StatusInternalServerError)
+		return
+	}
+	payees, err := loadActivePayees(ledgerID)
+	if err != nil {
+		http.Error(w, "Error fetching payees", http.StatusInternalServerError)
+		return
+	}
+	suggester, err := newCategorySuggester(ledgerID)
+	if err != nil {
+		http.Error(w, "Error building category suggestions", http.StatusInternalServerError)
+		return
+	}
+
+	rows := make([]importPreviewRow, len(request.Transactions))
+	for i, transaction := range request.Transactions {
+		transaction.Tags = normalizeTags(transaction.Tags)
+		ruleApplied := applyRules(rules, &transaction, false)
+		applyPayee(payees, &transaction)
+		rows[i] = importPreviewRow{
+			Index:       i,
+			RuleApplied: ruleApplied,
+			Suggestions: suggester.suggest(transaction.Description, transaction.Amount, transaction.Type),
+			Transaction: transaction,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"rows": rows})
+}
+
+// categorySuggester menggabungkan model user dengan daftar kategori aktifnya
+type categorySuggester struct {
+	model      *classifier.NaiveBayes
+	categories map[string]models.Category
+}
+
+func newCategorySuggester(userID primitive.ObjectID) (*categorySuggester, error) {
+	model, err := suggestionModel(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := database.CategoryCollection.Find(context.Background(), bson.M{"user_id": userID, "deleted_at": nil})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var categories []models.Category
+	if err = cursor.All(context.Background(), &categories); err != nil {
+		return nil, err
+	}
+
+	suggester := &categorySuggester{model: model, categories: make(map[string]models.Category, len(categories))}
+	for _, category := range categories {
+		suggester.categories[category.ID.Hex()] = category
+	}
+	return suggester, nil
+}
+
+// Fungsi helper untuk saran kategori terbaik. Kategori yang sudah dihapus atau bertipe
+// berbeda tidak disarankan.
+func (s *categorySuggester) suggest(description string, amount float64, transactionType string) []categorySuggestion {
+	suggestions := []categorySuggestion{}
+	if s.model.Documents() == 0 || strings.TrimSpace(description) == "" {
+		return suggestions
+	}
+
+	predictions := s.model.Predict(description, amount, func(label string) bool {
+		category, ok := s.categories[label]
+		return ok && (transactionType == "" || category.Type == transactionType)
+	})
+	for _, prediction := range predictions {
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+		category := s.categories[prediction.Label]
+		suggestions = append(suggestions, categorySuggestion{
+			CategoryID:   category.ID,
+			CategoryName: category.Name,
+			Type:         category.Type,
+			Confidence:   prediction.Confidence,
+		})
+	}
+	return suggestions
+}
+
+// Fungsi helper untuk mengambil model user dari cache atau melatihnya dari transaksi terbaru
+func suggestionModel(userID primitive.ObjectID) (*classifier.NaiveBayes, error) {
+	suggestionModels.Lock()
+	cached, ok := suggestionModels.byUser[userID]
+	suggestionModels.Unlock()
+	if ok && cached.model != nil && time.Since(cached.trainedAt) < suggestionModelTTL {
+		return cached.model, nil
+	}
+
+	trainedAt := time.Now()
+	opts := options.Find().
+		SetSort(bson.D{{Key: "date", Value: -1}}).
+		SetLimit(suggestionTrainingLimit).
+		SetProjection(bson.M{"description": 1, "amount": 1, "category_id": 1, "splits": 1})
+	cursor, err := database.TransactionCollection.Find(context.Background(), bson.M{"user_id": userID, "deleted_at": nil}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	model := classifier.NewNaiveBayes()
+	for cursor.Next(context.Background()) {
+		var transaction models.Transaction
+		if err := cursor.Decode(&transaction); err != nil {
+			return nil, err
+		}
+		// Transaksi split dilatih per baris dengan memo baris ditambahkan ke deskripsi
+		if len(transaction.Splits) > 0 {
+			for _, split := range transaction.Splits {
+				model.Train(split.CategoryID.Hex(), transaction.Description+" "+split.Memo, split.Amount)
+			}
+			continue
+		}
+		if !transaction.CategoryID.IsZero() {
+			model.Train(transaction.CategoryID.Hex(), transaction.Description, transaction.Amount)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	suggestionModels.Lock()
+	// Jangan simpan model jika transaksi user berubah selama pelatihan
+	if current, ok := suggestionModels.byUser[userID]; !ok || current.trainedAt.Before(trainedAt) {
+		suggestionModels.byUser[userID] = cachedSuggestionModel{model: model, trainedAt: trainedAt}
+	}
+	sweepSuggestionModels(time.Now())
+	suggestionModels.Unlock()
+	return model, nil
+}
+
+// Fungsi helper untuk membuang model user agar dilatih ulang pada permintaan berikutnya.
+// Waktu pembuangan dicatat supaya model yang sedang dilatih dari data lama tidak disimpan.
+func invalidateSuggestionModel(userID primitive.ObjectID) {
+	now := time.Now()
+	suggestionModels.Lock()
+	suggestionModels.byUser[userID] = cachedSuggestionModel{trainedAt: now}
+	sweepSuggestionModels(now)
+	suggestionModels.Unlock()
+}
+
+// Fungsi helper untuk menghapus model dan catatan pembuangan yang sudah kedaluwarsa, paling
+// sering sekali per suggestionModelTTL. Catatan yang lebih tua dari TTL aman dihapus karena
+// model yang dilatih sebelum waktu itu tetap dianggap kedaluwarsa saat dibaca. Dipanggil
+// saat memegang lock suggestionModels.
+func sweepSuggestionModels(now time.Time) {
+	if now.Sub(suggestionModels.sweptAt) < suggestionModelTTL {
+		return
+	}
+	for userID, cached := range suggestionModels.byUser {
+		if now.Sub(cached.trainedAt) >= suggestionModelTTL {
+			delete(suggestionModels.byUser, userID)
+		}
+	}
+	suggestionModels.sweptAt = now
+}
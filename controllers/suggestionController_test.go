@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"finance-app/classifier"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSuggestionModelCacheDropsExpiredEntries(t *testing.T) {
+	suggestionModels.Lock()
+	saved, savedSweptAt := suggestionModels.byUser, suggestionModels.sweptAt
+	suggestionModels.byUser = make(map[primitive.ObjectID]cachedSuggestionModel)
+	suggestionModels.sweptAt = time.Time{}
+	suggestionModels.Unlock()
+	t.Cleanup(func() {
+		suggestionModels.Lock()
+		suggestionModels.byUser, suggestionModels.sweptAt = saved, savedSweptAt
+		suggestionModels.Unlock()
+	})
+
+	now := time.Now()
+	stale, fresh := primitive.NewObjectID(), primitive.NewObjectID()
+	suggestionModels.byUser[stale] = cachedSuggestionModel{trainedAt: now.Add(-2 * suggestionModelTTL)}
+	suggestionModels.byUser[fresh] = cachedSuggestionModel{model: classifier.NewNaiveBayes(), trainedAt: now}
+
+	// Setiap penulisan transaksi menambah catatan pembuangan; yang kedaluwarsa ikut terhapus
+	writer := primitive.NewObjectID()
+	invalidateSuggestionModel(writer)
+
+	suggestionModels.Lock()
+	defer suggestionModels.Unlock()
+	if _, ok := suggestionModels.byUser[stale]; ok {
+		t.Error("expired entry was not removed")
+	}
+	if _, ok := suggestionModels.byUser[fresh]; !ok {
+		t.Error("fresh model was removed")
+	}
+	if cached, ok := suggestionModels.byUser[writer]; !ok || cached.model != nil {
+		t.Errorf("invalidation should leave a model-less marker, got %+v", cached)
+	}
+
+	// Sweep berikutnya baru berjalan setelah TTL, jadi tidak setiap penulisan memindai map
+	suggestionModels.byUser[stale] = cachedSuggestionModel{trainedAt: now.Add(-2 * suggestionModelTTL)}
+	sweepSuggestionModels(now.Add(time.Second))
+	if _, ok := suggestionModels.byUser[stale]; !ok {
+		t.Error("sweep ran again before the TTL elapsed")
+	}
+	sweepSuggestionModels(now.Add(suggestionModelTTL + time.Second))
+	if len(suggestionModels.byUser) != 0 {
+		t.Errorf("all entries should have expired, %d left", len(suggestionModels.byUser))
+	}
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"finance-app/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Fungsi helper untuk merapikan tag: huruf kecil, tanpa spasi di ujung, tanpa duplikat
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// GetTags mengembalikan tag milik user yang diawali ?prefix=, diurutkan dari yang paling sering dipakai
+func GetTags(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	prefix := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("prefix")))
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"user_id": ledgerID, "deleted_at": nil, "tags": bson.M{"$exists": true}}},
+		{"$unwind": "$tags"},
+		{"$match": bson.M{"tags": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}}},
+		{"$group": bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}},
+		{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+		{"$limit": 10},
+	}
+
+	cursor, err := database.TransactionCollection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		http.Error(w, "Error fetching tags", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	var result []struct {
+		Tag   string `bson:"_id" json:"tag"`
+		Count int    `bson:"count" json:"count"`
+	}
+	if err = cursor.All(context.Background(), &result); err != nil {
+		http.Error(w, "Error decoding tags", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetTagReport menghitung total pemasukan dan pengeluaran per tag dalam rentang tanggal
+func GetTagReport(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	startDate, endDate, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"user_id":    ledgerID,
+			"deleted_at": nil,
+			"tags":       bson.M{"$exists": true},
+			"date":       bson.M{"$gte": startDate, "$lt": endDate},
+		}},
+		{"$unwind": "$tags"},
+		{"$group": bson.M{
+			"_id": "$tags",
+			"total_income": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$type", "income"}}, "$amount", 0,
+			}}},
+			"total_expense": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$type", "expense"}}, "$amount", 0,
+			}}},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$sort": bson.M{"_id": 1}},
+	}
+
+	cursor, err := database.TransactionCollection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		http.Error(w, "Error generating tag report", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	var result []struct {
+		Tag          string  `bson:"_id" json:"tag"`
+		TotalIncome  float64 `bson:"total_income" json:"total_income"`
+		TotalExpense float64 `bson:"total_expense" json:"total_expense"`
+		Count        int     `bson:"count" json:"count"`
+	}
+	if err = cursor.All(context.Background(), &result); err != nil {
+		http.Error(w, "Error decoding tag report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -3,8 +3,12 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"finance-app/database"
@@ -12,18 +16,25 @@ import (
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	errInvalidTransactionType = errors.New("Invalid transaction type. Must be 'income' or 'expense'")
+	errInvalidSplits          = errors.New("Split amounts must be positive and sum to the transaction amount")
+	errTransactionChanged     = errors.New("Transaction was changed or deleted by another request; reload and retry")
 )
 
 func GetTransactions(w http.ResponseWriter, r *http.Request) {
-	// Ambil user ID dari context
-	userID := r.Context().Value("user_id").(primitive.ObjectID)
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
 
 	// Dapatkan parameter filter dari query string (jika ada)
 	startDateStr := r.URL.Query().Get("start_date")
 	endDateStr := r.URL.Query().Get("end_date")
 
 	// Buat filter berdasarkan tanggal (jika ada parameter)
-	filter := bson.M{"user_id": userID}
+	filter := bson.M{"user_id": ledgerID, "deleted_at": nil}
 	if startDateStr != "" && endDateStr != "" {
 		startDate, _ := time.Parse("2006-01-02", startDateStr)
 		endDate, _ := time.Parse("2006-01-02", endDateStr)
@@ -37,9 +48,43 @@ func GetTransactions(w http.ResponseWriter, r *http.Request) {
 		filter["date"] = bson.M{"$gte": firstOfMonth, "$lte": lastOfMonth}
 	}
 
-	// Query semua transaksi milik user dengan filter
+	// Filter berdasarkan tag (dipisahkan koma, transaksi harus memiliki semua tag)
+	if tags := normalizeTags(strings.Split(r.URL.Query().Get("tags"), ",")); len(tags) > 0 {
+		filter["tags"] = bson.M{"$all": tags}
+	}
+
+	// Filter berdasarkan anggota ledger yang mencatat transaksi
+	if createdBy := r.URL.Query().Get("created_by"); createdBy != "" {
+		memberID, err := primitive.ObjectIDFromHex(createdBy)
+		if err != nil {
+			http.Error(w, "Invalid created_by", http.StatusBadRequest)
+			return
+		}
+		filter["created_by"] = memberID
+	}
+
+	// Query semua transaksi milik user dengan filter. _id menjadi urutan kedua agar
+	// transaksi dengan tanggal sama selalu berurutan tetap antar halaman.
 	findOptions := options.Find()
-	findOptions.SetSort(bson.D{{"date", -1}}) // Urutkan berdasarkan tanggal terbaru
+	findOptions.SetSort(bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}}) // Urutkan berdasarkan tanggal terbaru
+
+	// Paginasi opsional dengan ?limit= dan ?page= (mulai dari 1)
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err := strconv.ParseInt(limitStr, 10, 64)
+		if err != nil || limit <= 0 || limit > 1000 {
+			http.Error(w, "Invalid limit. Must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		page := int64(1)
+		if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+			page, err = strconv.ParseInt(pageStr, 10, 64)
+			if err != nil || page <= 0 {
+				http.Error(w, "Invalid page. Must be 1 or greater", http.StatusBadRequest)
+				return
+			}
+		}
+		findOptions.SetLimit(limit).SetSkip((page - 1) * limit)
+	}
 
 	cursor, err := database.TransactionCollection.Find(context.Background(), filter, findOptions)
 	if err != nil {
@@ -54,13 +99,22 @@ func GetTransactions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Saldo berjalan seperti rekening koran, dihitung dari seluruh transaksi aktif
+	if r.URL.Query().Get("running_balance") == "true" {
+		if err := fillRunningBalances(ledgerID, transactions); err != nil {
+			http.Error(w, "Error calculating running balance", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(transactions)
 }
 
 func CreateTransaction(w http.ResponseWriter, r *http.Request) {
-	// Ambil user ID dari context
-	userID := r.Context().Value("user_id").(primitive.ObjectID)
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
 
 	var transaction models.Transaction
 	err := json.NewDecoder(r.Body).Decode(&transaction)
@@ -68,29 +122,70 @@ func CreateTransaction(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	transaction.UserID = userID // Set user ID pada transaksi
 	transaction.Date = time.Now()
+	transaction.ID = primitive.NilObjectID
+	// Tautan hutang/piutang dan cicilan hanya diisi oleh modul masing-masing
+	transaction.DebtID = nil
+	transaction.InstallmentPlanID, transaction.InstallmentNumber = nil, 0
 
-	// Validasi tipe transaksi
-	if transaction.Type != "income" && transaction.Type != "expense" {
-		http.Error(w, "Invalid transaction type. Must be 'income' or 'expense'", http.StatusBadRequest)
+	// Isi kategori, tag, dan payee dari aturan otomatis dan payee milik user
+	if err := autofillTransaction(ledgerID, &transaction); err != nil {
+		http.Error(w, "Error applying category rules", http.StatusInternalServerError)
+		return
+	}
+
+	// Validasi lalu simpan transaksi ke database
+	if err := insertTransaction(actorID, ledgerID, &transaction); err != nil {
+		if isValidationError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionETag(transaction.Version))
+	json.NewEncoder(w).Encode(map[string]interface{}{"inserted_id": transaction.ID})
+}
+
+func GetTransaction(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	params := mux.Vars(r)
+	transactionID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
 		return
 	}
 
-	// Simpan transaksi ke database
-	result, err := database.TransactionCollection.InsertOne(context.Background(), transaction)
+	var transaction models.Transaction
+	err = database.TransactionCollection.FindOne(context.Background(), bson.M{"_id": transactionID, "user_id": ledgerID, "deleted_at": nil}).Decode(&transaction)
 	if err != nil {
-		http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Transaction not found or not owned by user", http.StatusNotFound)
+		} else {
+			http.Error(w, "Error fetching transaction", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	etag := versionETag(transaction.Version)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"inserted_id": result.InsertedID})
+	json.NewEncoder(w).Encode(transaction)
 }
 
 func UpdateTransaction(w http.ResponseWriter, r *http.Request) {
-	// Ambil user ID dari context
-	userID := r.Context().Value("user_id").(primitive.ObjectID)
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
 
 	// Ambil transactionID dari URL params
 	params := mux.Vars(r)
@@ -108,38 +203,59 @@ func UpdateTransaction(w http.ResponseWriter, r *http.Request) {
 
 	}
 
-	// Validasi tipe transaksi
-	if transaction.Type != "income" && transaction.Type != "expense" {
-		http.Error(w, "Invalid transaction type. Must be 'income' or 'expense'", http.StatusBadRequest)
+	// Versi yang diharapkan client (If-Match) untuk mencegah menimpa perubahan orang lain
+	expectedVersion, hasIfMatch, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), ifMatchErrorStatus(err))
+		return
+	}
+
+	// Validasi tipe dan kategori transaksi
+	if err := validateTransaction(ledgerID, &transaction); err != nil {
+		if isValidationError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "Error validating category", http.StatusInternalServerError)
+		}
 		return
 	}
 
 	// Update transaksi di database (pastikan hanya transaksi milik user yang diupdate)
-	filter := bson.M{"_id": transactionID, "user_id": userID}
-	update := bson.M{"$set": bson.M{
-		"type":        transaction.Type,
-		"category_id": transaction.CategoryID,
-		"amount":      transaction.Amount,
-		"description": transaction.Description,
-	}}
-	result, err := database.TransactionCollection.UpdateOne(context.Background(), filter, update)
+	filter := bson.M{"_id": transactionID, "user_id": ledgerID, "deleted_at": nil}
+	if hasIfMatch {
+		filter["version"] = versionFilter(expectedVersion)
+	}
+	addDebtWriteCondition(filter, &transaction)
+	releaseBalance, err := beginBalanceWrite(ledgerID)
 	if err != nil {
-		http.Error(w, "Error updating transaction", http.StatusInternalServerError)
+		http.Error(w, "Error preparing balance snapshot", http.StatusInternalServerError)
 		return
 	}
-
-	if result.MatchedCount == 0 {
-		http.Error(w, "Transaction not found or not owned by user", http.StatusNotFound)
+	defer releaseBalance()
+	update := bson.M{"$set": transactionUpdateFields(transaction), "$inc": bson.M{"version": 1}}
+	var before models.Transaction
+	err = database.TransactionCollection.FindOneAndUpdate(context.Background(), filter, update).Decode(&before)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeTransactionWriteMiss(w, ledgerID, transactionID, hasIfMatch, &transaction)
+		} else {
+			http.Error(w, "Error updating transaction", http.StatusInternalServerError)
+		}
 		return
 	}
 
+	after := applyTransactionUpdate(before, transaction)
+	recordTransactionChange(actorID, before.UserID, "update", transactionID, &before, &after)
+
+	w.Header().Set("ETag", versionETag(after.Version))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Transaction updated successfully"})
 }
 
 func DeleteTransaction(w http.ResponseWriter, r *http.Request) {
-	// Ambil user ID dari context
-	userID := r.Context().Value("user_id").(primitive.ObjectID)
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
 
 	params := mux.Vars(r)
 	transactionID, err := primitive.ObjectIDFromHex(params["id"])
@@ -148,19 +264,203 @@ func DeleteTransaction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Hapus transaksi dari database (pastikan hanya transaksi milik user yang dihapus)
-	filter := bson.M{"_id": transactionID, "user_id": userID}
-	result, err := database.TransactionCollection.DeleteOne(context.Background(), filter)
+	expectedVersion, hasIfMatch, err := parseIfMatch(r)
 	if err != nil {
-		http.Error(w, "Error deleting transaction", http.StatusInternalServerError)
+		http.Error(w, err.Error(), ifMatchErrorStatus(err))
 		return
 	}
 
-	if result.DeletedCount == 0 {
-		http.Error(w, "Transaction not found or not owned by user", http.StatusNotFound)
+	// Pindahkan transaksi ke tempat sampah (pastikan hanya transaksi milik user yang dihapus)
+	now := time.Now()
+	filter := bson.M{"_id": transactionID, "user_id": ledgerID, "deleted_at": nil}
+	if hasIfMatch {
+		filter["version"] = versionFilter(expectedVersion)
+	}
+	addDebtWriteCondition(filter, nil)
+	releaseBalance, err := beginBalanceWrite(ledgerID)
+	if err != nil {
+		http.Error(w, "Error preparing balance snapshot", http.StatusInternalServerError)
+		return
+	}
+	defer releaseBalance()
+	update := bson.M{"$set": bson.M{"deleted_at": now}, "$inc": bson.M{"version": 1}}
+	var deleted models.Transaction
+	err = database.TransactionCollection.FindOneAndUpdate(context.Background(), filter, update).Decode(&deleted)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeTransactionWriteMiss(w, ledgerID, transactionID, hasIfMatch, nil)
+		} else {
+			http.Error(w, "Error deleting transaction", http.StatusInternalServerError)
+		}
 		return
 	}
+	recordTransactionChange(actorID, deleted.UserID, "delete", transactionID, &deleted, nil)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Transaction deleted successfully"})
 }
+
+// Fungsi helper untuk memvalidasi transaksi sebelum disimpan: tipe, tag, dan kategori
+func validateTransaction(userID primitive.ObjectID, transaction *models.Transaction) error {
+	if transaction.Type != "income" && transaction.Type != "expense" {
+		return errInvalidTransactionType
+	}
+	transaction.Tags = normalizeTags(transaction.Tags)
+	if err := checkTransactionPayee(userID, transaction.PayeeID); err != nil {
+		return err
+	}
+	return checkTransactionCategories(userID, transaction)
+}
+
+// Fungsi helper untuk menyimpan transaksi baru di ledger userID atas nama actorID (kosong
+// untuk job background): memberi ID (jika belum ada) dan versi awal, memvalidasi, menyimpan, lalu mencatat perubahan (audit dan snapshot
+// saldo). Kesalahan validasi dikembalikan apa adanya agar bisa dibedakan dengan
+// isValidationError.
+func insertTransaction(actorID, userID primitive.ObjectID, transaction *models.Transaction) error {
+	if transaction.ID.IsZero() {
+		transaction.ID = primitive.NewObjectID()
+	}
+	transaction.UserID = userID
+	transaction.Version = 1
+	transaction.DeletedAt, transaction.DeletedWith = nil, nil
+	transaction.CreatedBy = nil
+	if !actorID.IsZero() {
+		transaction.CreatedBy = &actorID
+	}
+
+	if err := validateTransaction(userID, transaction); err != nil {
+		return err
+	}
+	releaseBalance, err := beginBalanceWrite(userID)
+	if err != nil {
+		return err
+	}
+	defer releaseBalance()
+	if _, err := database.TransactionCollection.InsertOne(context.Background(), transaction); err != nil {
+		return err
+	}
+	recordTransactionChange(actorID, userID, "create", transaction.ID, nil, transaction)
+	return nil
+}
+
+// Fungsi helper untuk transaksi baru: aturan otomatis dievaluasi lebih dulu, lalu
+// transaksi ditautkan ke payee dan kategori bawaan payee dipakai jika masih kosong
+func autofillTransaction(userID primitive.ObjectID, transaction *models.Transaction) error {
+	rules, err := loadActiveRules(userID)
+	if err != nil {
+		return err
+	}
+	payees, err := loadActivePayees(userID)
+	if err != nil {
+		return err
+	}
+	applyRules(rules, transaction, false)
+	applyPayee(payees, transaction)
+	return nil
+}
+
+// Fungsi helper untuk membedakan kesalahan input (400) dari kesalahan database (500)
+func isValidationError(err error) bool {
+	switch err {
+	case errInvalidTransactionType, errCategoryNotFound, errCategoryTypeMismatch, errInvalidSplits, errPayeeNotFound:
+		return true
+	}
+	return false
+}
+
+// Field yang boleh diubah melalui update transaksi
+func transactionUpdateFields(transaction models.Transaction) bson.M {
+	return bson.M{
+		"type":        transaction.Type,
+		"category_id": transaction.CategoryID,
+		"amount":      transaction.Amount,
+		"description": transaction.Description,
+		"tags":        transaction.Tags,
+		"splits":      transaction.Splits,
+		"payee_id":    transaction.PayeeID,
+	}
+}
+
+// Fungsi helper untuk menyusun dokumen setelah update (untuk audit log)
+func applyTransactionUpdate(before, transaction models.Transaction) models.Transaction {
+	after := before
+	after.Type = transaction.Type
+	after.CategoryID = transaction.CategoryID
+	after.Amount = transaction.Amount
+	after.Description = transaction.Description
+	after.Tags = transaction.Tags
+	after.Splits = transaction.Splits
+	after.PayeeID = transaction.PayeeID
+	after.Version = before.Version + 1
+	return after
+}
+
+// Fungsi helper saat update/delete tidak menemukan dokumen: 409 jika transaksi tertaut ke
+// hutang dan penulisan akan membuat hutang tidak sinkron (update nil berarti delete), 412
+// jika versinya berbeda dari If-Match, 404 jika transaksi memang tidak ada
+func writeTransactionWriteMiss(w http.ResponseWriter, userID, transactionID primitive.ObjectID, hasIfMatch bool, update *models.Transaction) {
+	var current models.Transaction
+	err := database.TransactionCollection.FindOne(context.Background(), bson.M{"_id": transactionID, "user_id": userID, "deleted_at": nil}).Decode(&current)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		http.Error(w, "Transaction not found or not owned by user", http.StatusNotFound)
+	case err != nil:
+		http.Error(w, "Error finding transaction", http.StatusInternalServerError)
+	case !debtWriteAllowed(current, update):
+		http.Error(w, errDebtLinkedTransaction.Error(), http.StatusConflict)
+	case hasIfMatch:
+		http.Error(w, errVersionMismatch.Error(), http.StatusPreconditionFailed)
+	default:
+		// Transaksi berubah di antara penulisan dan pengecekan ini
+		http.Error(w, errTransactionChanged.Error(), http.StatusConflict)
+	}
+}
+
+// Fungsi helper untuk memvalidasi kategori transaksi. Jika transaksi memiliki split,
+// setiap baris split divalidasi dan kategori induk dikosongkan.
+func checkTransactionCategories(userID primitive.ObjectID, transaction *models.Transaction) error {
+	if len(transaction.Splits) == 0 {
+		return checkTransactionCategory(userID, transaction.CategoryID, transaction.Type)
+	}
+
+	var total float64
+	for _, split := range transaction.Splits {
+		if split.Amount <= 0 {
+			return errInvalidSplits
+		}
+		if err := checkTransactionCategory(userID, split.CategoryID, transaction.Type); err != nil {
+			return err
+		}
+		total += split.Amount
+	}
+
+	// Bandingkan dalam satuan sen untuk menghindari selisih pembulatan float
+	if math.Round(total*100) != math.Round(transaction.Amount*100) {
+		return errInvalidSplits
+	}
+
+	transaction.CategoryID = primitive.NilObjectID
+	return nil
+}
+
+// Fungsi helper untuk memindahkan transaksi yang baru dibuat ke tempat sampah saat langkah
+// berikutnya gagal, beserta audit dan delta saldonya
+func trashTransaction(actorID, userID, transactionID primitive.ObjectID) error {
+	releaseBalance, err := beginBalanceWrite(userID)
+	if err != nil {
+		return err
+	}
+	defer releaseBalance()
+
+	var deleted models.Transaction
+	err = database.TransactionCollection.FindOneAndUpdate(context.Background(),
+		bson.M{"_id": transactionID, "user_id": userID, "deleted_at": nil},
+		bson.M{"$set": bson.M{"deleted_at": time.Now()}, "$inc": bson.M{"version": 1}}).Decode(&deleted)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	recordTransactionChange(actorID, userID, "delete", deleted.ID, &deleted, nil)
+	return nil
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"finance-app/config"
+	"finance-app/database"
+	"finance-app/models"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Lama penyimpanan item di tempat sampah sebelum dihapus permanen
+func trashRetention() time.Duration {
+	return time.Duration(config.GetEnvInt64("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour
+}
+
+// GetTrash mengembalikan transaksi dan kategori milik user yang ada di tempat sampah
+func GetTrash(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+
+	filter := bson.M{"user_id": ledgerID, "deleted_at": bson.M{"$ne": nil}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: -1}})
+
+	cursor, err := database.TransactionCollection.Find(context.Background(), filter, findOptions)
+	if err != nil {
+		http.Error(w, "Error fetching trash", http.StatusInternalServerError)
+		return
+	}
+	var transactions []models.Transaction
+	if err = cursor.All(context.Background(), &transactions); err != nil {
+		http.Error(w, "Error decoding trash", http.StatusInternalServerError)
+		return
+	}
+
+	cursor, err = database.CategoryCollection.Find(context.Background(), filter, findOptions)
+	if err != nil {
+		http.Error(w, "Error fetching trash", http.StatusInternalServerError)
+		return
+	}
+	var categories []models.Category
+	if err = cursor.All(context.Background(), &categories); err != nil {
+		http.Error(w, "Error decoding trash", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"transactions":   transactions,
+		"categories":     categories,
+		"retention_days": int(trashRetention().Hours() / 24),
+	})
+}
+
+// RestoreFromTrash mengembalikan transaksi atau kategori dari tempat sampah. Memulihkan
+// kategori juga memulihkan transaksi yang ikut terhapus bersamanya (cascade).
+func RestoreFromTrash(w http.ResponseWriter, r *http.Request) {
+	// Ambil ledger aktif dari context
+	ledgerID := r.Context().Value("ledger_id").(primitive.ObjectID)
+	actorID := r.Context().Value("user_id").(primitive.ObjectID)
+
+	params := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	filter := bson.M{"_id": id, "user_id": ledgerID, "deleted_at": bson.M{"$ne": nil}}
+	restore := bson.M{"$unset": bson.M{"deleted_at": "", "deleted_with": ""}}
+	restoreTransaction := bson.M{"$unset": bson.M{"deleted_at": "", "deleted_with": ""}, "$inc": bson.M{"version": 1}}
+
+	// Coba pulihkan sebagai transaksi
+	var transaction models.Transaction
+	err = database.TransactionCollection.FindOne(context.Background(), filter).Decode(&transaction)
+	if err == nil {
+		// Kategori transaksi harus masih aktif
+		check := transaction
+		if err := checkTransactionCategories(ledgerID, &check); err != nil {
+			if isValidationError(err) {
+				http.Error(w, "Category of this transaction is deleted; restore or reassign it first", http.StatusConflict)
+			} else {
+				http.Error(w, "Error validating category", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		releaseBalance, err := beginBalanceWrite(ledgerID)
+		if err != nil {
+			http.Error(w, "Error preparing balance snapshot", http.StatusInternalServerError)
+			return
+		}
+		defer releaseBalance()
+		result, err := database.TransactionCollection.UpdateOne(context.Background(), filter, restoreTransaction)
+		if err != nil {
+			http.Error(w, "Error restoring transaction", http.StatusInternalServerError)
+			return
+		}
+		if result.ModifiedCount == 0 {
+			// Sudah dipulihkan oleh request lain
+			http.Error(w, "Item not found in trash", http.StatusNotFound)
+			return
+		}
+		after := transaction
+		after.DeletedAt, after.DeletedWith = nil, nil
+		after.Version++
+		recordTransactionChange(actorID, ledgerID, "restore", id, &transaction, &after)
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Transaction restored successfully"})
+		return
+	}
+	if err != mongo.ErrNoDocuments {
+		http.Error(w, "Error finding transaction", http.StatusInternalServerError)
+		return
+	}
+
+	// Coba pulihkan sebagai kategori
+	var category models.Category
+	err = database.CategoryCollection.FindOne(context.Background(), filter).Decode(&category)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Item not found in trash", http.StatusNotFound)
+		} else {
+			http.Error(w, "Error finding category", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if _, err := database.CategoryCollection.UpdateOne(context.Background(), filter, restore); err != nil {
+		http.Error(w, "Error restoring category", http.StatusInternalServerError)
+		return
+	}
+	after := category
+	after.DeletedAt = nil
+	recordAudit(actorID, ledgerID, "categories", "restore", id, &category, &after)
+
+	// Pulihkan transaksi yang terhapus bersama kategori ini
+	cascaded, err := findTransactions(bson.M{"user_id": ledgerID, "deleted_with": id})
+	if err != nil {
+		http.Error(w, "Error finding category transactions", http.StatusInternalServerError)
+		return
+	}
+	releaseBalance, err := beginBalanceWrite(ledgerID)
+	if err != nil {
+		http.Error(w, "Error preparing balance snapshot", http.StatusInternalServerError)
+		return
+	}
+	defer releaseBalance()
+
+	// Dipulihkan satu per satu agar transaksi yang dipulihkan request lain tidak dihitung dua kali
+	var restored int64
+	for i := range cascaded {
+		result, err := database.TransactionCollection.UpdateOne(context.Background(),
+			bson.M{"_id": cascaded[i].ID, "deleted_with": id, "deleted_at": bson.M{"$ne": nil}}, restoreTransaction)
+		if err != nil {
+			http.Error(w, "Error restoring category transactions", http.StatusInternalServerError)
+			return
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		restored++
+		after := cascaded[i]
+		after.DeletedAt, after.DeletedWith = nil, nil
+		after.Version++
+		recordTransactionChange(actorID, ledgerID, "restore", cascaded[i].ID, &cascaded[i], &after)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":               "Category restored successfully",
+		"restored_transactions": restored,
+	})
+}
+
+// PurgeTrash menghapus permanen transaksi (beserta lampirannya) dan kategori
+// yang sudah berada di tempat sampah sejak sebelum cutoff.
+func PurgeTrash(cutoff time.Time) error {
+	filter := bson.M{"deleted_at": bson.M{"$lt": cutoff}}
+
+	transactions, err := findTransactions(filter)
+	if err != nil {
+		return err
+	}
+	idsByUser := make(map[primitive.ObjectID][]primitive.ObjectID)
+	for _, transaction := range transactions {
+		idsByUser[transaction.UserID] = append(idsByUser[transaction.UserID], transaction.ID)
+	}
+	for userID, ids := range idsByUser {
+		if err := deleteTransactionAttachments(userID, ids); err != nil {
+			return err
+		}
+		if _, err := database.TransactionCollection.DeleteMany(context.Background(), bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+			return err
+		}
+	}
+	for i := range transactions {
+		recordTransactionChange(primitive.NilObjectID, transactions[i].UserID, "purge", transactions[i].ID, &transactions[i], nil)
+	}
+
+	cursor, err := database.CategoryCollection.Find(context.Background(), filter)
+	if err != nil {
+		return err
+	}
+	var categories []models.Category
+	if err = cursor.All(context.Background(), &categories); err != nil {
+		return err
+	}
+	for i := range categories {
+		if _, err := database.CategoryCollection.DeleteOne(context.Background(), bson.M{"_id": categories[i].ID}); err != nil {
+			return err
+		}
+		recordAudit(primitive.NilObjectID, categories[i].UserID, "categories", "purge", categories[i].ID, &categories[i], nil)
+	}
+
+	if len(transactions) > 0 || len(categories) > 0 {
+		log.Printf("Purged %d transactions and %d categories from trash", len(transactions), len(categories))
+	}
+	return nil
+}
+
+// StartTrashPurge menjalankan PurgeTrash secara berkala di background
+func StartTrashPurge(interval time.Duration) {
+	go func() {
+		for {
+			if err := PurgeTrash(time.Now().Add(-trashRetention())); err != nil {
+				log.Printf("Error purging trash: %v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -5,11 +5,14 @@ import (
 	"encoding/json"
 	"finance-app/database"
 	"finance-app/models"
-	"finance-app/utils"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
+	"log"
 	"net/http"
+	"net/mail"
+	"time"
 )
 
 func RegisterUser(w http.ResponseWriter, r *http.Request) {
@@ -27,14 +30,53 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	user.Password = string(hashedPassword)
+	user.ID = primitive.NilObjectID
+	user.Role = "" // Role admin hanya bisa diberikan langsung di database
 
-	// Simpan user ke database
-	_, err = database.UserCollection.InsertOne(context.Background(), user)
+	// Validasi bahasa untuk kategori bawaan
+	if user.Locale == "" {
+		user.Locale = defaultLocale
+	}
+	if !isSupportedLocale(user.Locale) {
+		http.Error(w, "Unsupported locale. Must be 'id' or 'en'", http.StatusBadRequest)
+		return
+	}
+
+	// Validasi zona waktu untuk laporan dan grafik
+	if user.Timezone != "" {
+		if _, err := time.LoadLocation(user.Timezone); err != nil {
+			http.Error(w, "Invalid timezone. Use an IANA name such as 'Asia/Jakarta'", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validasi email tujuan token reset password
+	if user.Email != "" {
+		address, err := mail.ParseAddress(user.Email)
+		if err != nil {
+			http.Error(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
+		user.Email = address.Address
+	}
+
+	// Simpan user ke database. Username unik dijaga index, sehingga dari pendaftaran
+	// bersamaan dengan username sama hanya satu yang lolos
+	result, err := database.UserCollection.InsertOne(context.Background(), user)
+	if mongo.IsDuplicateKeyError(err) {
+		http.Error(w, "Username is already taken", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error registering user", http.StatusInternalServerError)
 		return
 	}
 
+	// Salin kategori bawaan ke akun user baru
+	if err := seedDefaultCategories(result.InsertedID.(primitive.ObjectID), user.Locale); err != nil {
+		log.Printf("Error seeding default categories: %v", err)
+	}
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{"message": "User registered successfully"})
 }
@@ -69,13 +111,13 @@ func LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate token JWT
-	token, err := utils.GenerateToken(user.ID)
+	// Generate access token dan refresh token untuk sesi baru
+	session, err := issueSession(user.ID, primitive.NewObjectID())
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	json.NewEncoder(w).Encode(session)
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"log"
 
+	"finance-app/config"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -13,6 +15,25 @@ var (
 	UserCollection        *mongo.Collection
 	CategoryCollection    *mongo.Collection
 	TransactionCollection *mongo.Collection
+
+	CategoryTemplateCollection *mongo.Collection
+	AttachmentCollection       *mongo.Collection
+	AttachmentUsageCollection  *mongo.Collection
+	AuditLogCollection         *mongo.Collection
+	IdempotencyKeyCollection   *mongo.Collection
+	BalanceCollection          *mongo.Collection
+	CategoryRuleCollection     *mongo.Collection
+	PayeeCollection            *mongo.Collection
+	DebtCollection             *mongo.Collection
+	InstallmentPlanCollection  *mongo.Collection
+	LedgerCollection           *mongo.Collection
+	GroupExpenseCollection     *mongo.Collection
+	GroupSettlementCollection  *mongo.Collection
+	GroupEntryCollection       *mongo.Collection
+	GroupPositionCollection    *mongo.Collection
+	RefreshTokenCollection     *mongo.Collection
+	RevokedSessionCollection   *mongo.Collection
+	PasswordResetCollection    *mongo.Collection
 )
 
 func ConnectDB() (*mongo.Client, error) {
@@ -28,6 +49,8 @@ func ConnectDB() (*mongo.Client, error) {
 		return nil, err
 	}
 
+	Client = client
+
 	// Pilih database
 	db := client.Database("finance_app")
 
@@ -35,7 +58,147 @@ func ConnectDB() (*mongo.Client, error) {
 	UserCollection = db.Collection("users")
 	CategoryCollection = db.Collection("categories")
 	TransactionCollection = db.Collection("transactions")
+	CategoryTemplateCollection = db.Collection("category_templates")
+	AttachmentCollection = db.Collection("attachments")
+	AttachmentUsageCollection = db.Collection("attachment_usage")
+	AuditLogCollection = db.Collection("audit_logs")
+	IdempotencyKeyCollection = db.Collection("idempotency_keys")
+	BalanceCollection = db.Collection("balances")
+	CategoryRuleCollection = db.Collection("category_rules")
+	PayeeCollection = db.Collection("payees")
+	DebtCollection = db.Collection("debts")
+	InstallmentPlanCollection = db.Collection("installment_plans")
+	LedgerCollection = db.Collection("ledgers")
+	GroupExpenseCollection = db.Collection("group_expenses")
+	GroupSettlementCollection = db.Collection("group_settlements")
+	GroupEntryCollection = db.Collection("group_entries")
+	GroupPositionCollection = db.Collection("group_positions")
+	RefreshTokenCollection = db.Collection("refresh_tokens")
+	RevokedSessionCollection = db.Collection("revoked_sessions")
+	PasswordResetCollection = db.Collection("password_reset_tokens")
+
+	// Pastikan index yang dibutuhkan query sudah tersedia
+	if err := createIndexes(); err != nil {
+		return nil, err
+	}
 
 	log.Println("Connected to MongoDB!")
 	return client, nil
 }
+
+func createIndexes() error {
+	indexes := []struct {
+		collection *mongo.Collection
+		model      mongo.IndexModel
+	}{
+		// Username dipakai untuk login dan reset password sehingga harus unik. Hapus
+		// duplikat yang sudah ada sebelum menjalankan versi ini, atau index gagal dibuat.
+		{UserCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}},
+		// Index multikey untuk filter dan laporan per tag
+		{TransactionCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "tags", Value: 1}},
+		}},
+		{AttachmentCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "transaction_id", Value: 1}},
+		}},
+		// Index untuk pembersihan tempat sampah
+		{TransactionCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"deleted_at": bson.M{"$exists": true}}),
+		}},
+		// Riwayat per dokumen dan per user, terbaru lebih dulu
+		{AuditLogCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "document_id", Value: 1}, {Key: "timestamp", Value: -1}},
+		}},
+		{AuditLogCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "timestamp", Value: -1}},
+		}},
+		// Satu key per user, dihapus otomatis setelah masa berlaku (TTL)
+		{IdempotencyKeyCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}},
+		{IdempotencyKeyCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(config.GetEnvInt64("IDEMPOTENCY_TTL_HOURS", 24) * 3600)),
+		}},
+		// Satu snapshot saldo per user per periode
+		{BalanceCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "period", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}},
+		{CategoryRuleCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "priority", Value: 1}},
+		}},
+		// Nama payee unik per user setelah dinormalisasi
+		{PayeeCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "normalized_name", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}},
+		{TransactionCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "payee_id", Value: 1}},
+		}},
+		{DebtCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "settled_at", Value: 1}, {Key: "due_date", Value: 1}},
+		}},
+		// Dipakai job pencatatan cicilan yang jatuh tempo
+		{InstallmentPlanCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "installments.due_date", Value: 1}},
+		}},
+		// Dipakai AuthMiddleware untuk memeriksa keanggotaan ledger
+		{LedgerCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "members.user_id", Value: 1}, {Key: "deleted_at", Value: 1}},
+		}},
+		{TransactionCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_by", Value: 1}},
+		}},
+		{GroupExpenseCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "date", Value: -1}},
+		}},
+		{GroupSettlementCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "date", Value: -1}},
+		}},
+		// Bagian patungan yang menunggu konfirmasi per anggota
+		{GroupEntryCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "status", Value: 1}, {Key: "date", Value: -1}},
+		}},
+		{GroupEntryCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "group_expense_id", Value: 1}},
+		}},
+		// Refresh token dicari berdasarkan hash dan dihapus otomatis setelah kedaluwarsa
+		{RefreshTokenCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}},
+		{RefreshTokenCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "family_id", Value: 1}},
+		}},
+		{RefreshTokenCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		}},
+		{RevokedSessionCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		}},
+		// Token reset password dicari berdasarkan hash dan dihapus setelah kedaluwarsa
+		{PasswordResetCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}},
+		{PasswordResetCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		}},
+	}
+
+	for _, index := range indexes {
+		if _, err := index.collection.Indexes().CreateOne(context.Background(), index.model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package database
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SplitLineStages memecah setiap transaksi menjadi satu dokumen per baris split
+// sehingga category_id dan amount mengacu ke baris tersebut. Transaksi tanpa split
+// tetap menjadi satu baris dengan kategori dan amount induknya.
+func SplitLineStages() []bson.M {
+	return []bson.M{
+		{"$addFields": bson.M{"lines": bson.M{"$cond": bson.A{
+			bson.M{"$gt": bson.A{bson.M{"$size": bson.M{"$ifNull": bson.A{"$splits", bson.A{}}}}, 0}},
+			"$splits",
+			bson.A{bson.M{"category_id": "$category_id", "amount": "$amount"}},
+		}}}},
+		{"$unwind": "$lines"},
+		{"$addFields": bson.M{
+			"category_id": "$lines.category_id",
+			"amount":      "$lines.amount",
+		}},
+		{"$project": bson.M{"lines": 0, "splits": 0}},
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"context"
+	"finance-app/database"
+	"finance-app/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+// AdminMiddleware harus dipasang setelah AuthMiddleware
+func AdminMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := r.Context().Value("user_id").(primitive.ObjectID)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var user models.User
+			err := database.UserCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+			if err != nil || user.Role != "admin" {
+				http.Error(w, "Admin access required", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
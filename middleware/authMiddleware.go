@@ -2,12 +2,13 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"finance-app/database"
 	"finance-app/models"
 	"finance-app/utils"
-	"github.com/dgrijalva/jwt-go"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"net/http"
 	"strings"
 )
@@ -21,25 +22,31 @@ func AuthMiddleware() func(http.Handler) http.Handler {
 				return
 			}
 
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			token, err := utils.ValidateToken(tokenString)
-			if err != nil || !token.Valid {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+			tokenString, ok := strings.CutPrefix(authHeader, "Bearer ")
+			if !ok || strings.TrimSpace(tokenString) == "" {
+				http.Error(w, "Invalid authorization header", http.StatusUnauthorized)
 				return
 			}
 
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok {
-				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+			claims, err := utils.ValidateToken(strings.TrimSpace(tokenString))
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
 
-			userID, err := primitive.ObjectIDFromHex(claims["user_id"].(string))
+			userID, err := primitive.ObjectIDFromHex(claims.UserID)
 			if err != nil {
 				http.Error(w, "Invalid user ID", http.StatusUnauthorized)
 				return
 			}
 
+			// Setiap access token terikat ke satu sesi (keluarga refresh token)
+			sessionID, err := primitive.ObjectIDFromHex(claims.SessionID)
+			if err != nil {
+				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+				return
+			}
+
 			// Check if user exists
 			var user models.User
 			err = database.UserCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
@@ -48,9 +55,114 @@ func AuthMiddleware() func(http.Handler) http.Handler {
 				return
 			}
 
-			// Set user ID in context
+			// Tolak token dari sesi yang sudah logout atau diterbitkan sebelum logout-all
+			if claims.TokenVersion != user.TokenVersion {
+				http.Error(w, errTokenRevoked.Error(), http.StatusUnauthorized)
+				return
+			}
+			revoked, err := database.RevokedSessionCollection.CountDocuments(context.Background(), bson.M{"_id": sessionID})
+			if err != nil {
+				http.Error(w, "Error checking token revocation", http.StatusInternalServerError)
+				return
+			}
+			if revoked > 0 {
+				http.Error(w, errTokenRevoked.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			// Tentukan ledger aktif dari header X-Ledger-ID (default ledger pribadi)
+			ledgerID, role, err := resolveLedger(r, userID)
+			if err == errLedgerAccessDenied {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			} else if err != nil {
+				http.Error(w, "Error resolving ledger", http.StatusInternalServerError)
+				return
+			}
+			// Viewer hanya boleh membaca ledger aktif; endpoint di luar ledger memakai ledger pribadi
+			if role == "viewer" && !isReadOnlyRequest(r) {
+				http.Error(w, errLedgerReadOnly.Error(), http.StatusForbidden)
+				return
+			}
+
+			// Set user ID, ledger dan sesi in context
 			ctx := context.WithValue(r.Context(), "user_id", userID)
+			ctx = context.WithValue(ctx, "ledger_id", ledgerID)
+			ctx = context.WithValue(ctx, "ledger_role", role)
+			ctx = context.WithValue(ctx, "session_id", sessionID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+var (
+	errTokenRevoked       = errors.New("Token has been revoked")
+	errLedgerAccessDenied = errors.New("Ledger not found or you are not a member")
+	errLedgerReadOnly     = errors.New("Viewers cannot modify this ledger")
+)
+
+// Endpoint yang tidak bekerja pada ledger aktif: sesi dan akun, pengelolaan ledger lewat
+// path, dan admin. Header X-Ledger-ID diabaikan di sini sehingga, misalnya, viewer tetap
+// bisa logout atau mengganti password tanpa melepas header tersebut.
+var unscopedPathPrefixes = []string{"/auth/", "/ledgers", "/admin/"}
+
+func isLedgerScoped(path string) bool {
+	for _, prefix := range unscopedPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// Endpoint POST yang hanya menghitung hasil tanpa menyimpan apa pun sehingga boleh
+// dipanggil viewer
+var readOnlyPostPaths = map[string]bool{
+	"/rules/test":                  true,
+	"/transactions/import/preview": true,
+}
+
+func isReadOnlyRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPost:
+		return readOnlyPostPaths[r.URL.Path]
+	}
+	return false
+}
+
+// Fungsi helper untuk ledger aktif request beserta peran user di dalamnya. Ledger
+// pribadi memakai ID user dan user selalu menjadi owner-nya, termasuk untuk endpoint yang
+// tidak bekerja pada ledger aktif (lihat isLedgerScoped).
+func resolveLedger(r *http.Request, userID primitive.ObjectID) (primitive.ObjectID, string, error) {
+	header := r.Header.Get("X-Ledger-ID")
+	if header == "" || !isLedgerScoped(r.URL.Path) {
+		return userID, "owner", nil
+	}
+	ledgerID, err := primitive.ObjectIDFromHex(header)
+	if err != nil {
+		return primitive.NilObjectID, "", errLedgerAccessDenied
+	}
+	if ledgerID == userID {
+		return userID, "owner", nil
+	}
+
+	var ledger models.Ledger
+	err = database.LedgerCollection.FindOne(context.Background(), bson.M{
+		"_id":        ledgerID,
+		"deleted_at": nil,
+		"members":    bson.M{"$elemMatch": bson.M{"user_id": userID, "status": "active"}},
+	}).Decode(&ledger)
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, "", errLedgerAccessDenied
+	} else if err != nil {
+		return primitive.NilObjectID, "", err
+	}
+	for _, member := range ledger.Members {
+		if member.UserID == userID {
+			return ledgerID, member.Role, nil
+		}
+	}
+	return primitive.NilObjectID, "", errLedgerAccessDenied
+}
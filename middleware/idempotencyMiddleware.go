@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"finance-app/config"
+	"finance-app/database"
+	"finance-app/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// responseRecorder meneruskan respons ke client sambil menyimpan salinannya
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// IdempotencyMiddleware harus dipasang setelah AuthMiddleware. Request POST/PUT/DELETE
+// dengan header Idempotency-Key hanya diproses sekali per user dan key; request ulang
+// mendapat respons yang tersimpan, dan key yang dipakai ulang dengan payload berbeda
+// ditolak dengan 422. Endpoint /auth/ tidak diproses karena responsnya bisa berisi token
+// yang tidak boleh tersimpan di database.
+func IdempotencyMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete) ||
+				strings.HasPrefix(r.URL.Path, "/auth/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > 255 {
+				http.Error(w, "Idempotency-Key must be at most 255 characters", http.StatusBadRequest)
+				return
+			}
+
+			userID, ok := r.Context().Value("user_id").(primitive.ObjectID)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			// Baca body untuk fingerprint, lalu kembalikan agar bisa dibaca handler. Body
+			// dibatasi karena seluruhnya disimpan di memori.
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes()))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					http.Error(w, "Request body is too large", http.StatusRequestEntityTooLarge)
+				} else {
+					http.Error(w, "Error reading request body", http.StatusBadRequest)
+				}
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			hash := sha256.New()
+			hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + " " + r.Header.Get("X-Ledger-ID") + "\n"))
+			hash.Write(body)
+			fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+			record := models.IdempotencyKey{
+				UserID:      userID,
+				Key:         key,
+				Fingerprint: fingerprint,
+				CreatedAt:   time.Now(),
+			}
+			result, err := database.IdempotencyKeyCollection.InsertOne(context.Background(), record)
+			if mongo.IsDuplicateKeyError(err) {
+				replayIdempotentResponse(w, userID, key, fingerprint)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Error storing idempotency key", http.StatusInternalServerError)
+				return
+			}
+			recordID := result.InsertedID
+
+			// Key dilepas jika handler panic agar tidak tertahan sampai TTL
+			defer func() {
+				if p := recover(); p != nil {
+					releaseIdempotencyKey(recordID)
+					panic(p)
+				}
+			}()
+
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			// Respons 5xx tidak disimpan supaya client bisa mencoba lagi dengan key yang sama
+			if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+				releaseIdempotencyKey(recordID)
+				return
+			}
+
+			_, err = database.IdempotencyKeyCollection.UpdateOne(context.Background(), bson.M{"_id": recordID}, bson.M{"$set": bson.M{
+				"completed":   true,
+				"status_code": rec.status,
+				"headers":     replayableHeaders(rec.Header()),
+				"body":        rec.body.Bytes(),
+			}})
+			if err != nil {
+				log.Printf("Error saving idempotent response: %v", err)
+			}
+		})
+	}
+}
+
+// Fungsi helper untuk menghapus key yang responsnya tidak disimpan
+func releaseIdempotencyKey(recordID interface{}) {
+	if _, err := database.IdempotencyKeyCollection.DeleteOne(context.Background(), bson.M{"_id": recordID}); err != nil {
+		log.Printf("Error releasing idempotency key: %v", err)
+	}
+}
+
+// Batas body request yang di-buffer untuk fingerprint. Default-nya cukup untuk satu
+// lampiran (ATTACHMENT_MAX_BYTES) beserta header multipart.
+func maxIdempotentBodyBytes() int64 {
+	return config.GetEnvInt64("IDEMPOTENCY_MAX_BODY_BYTES", config.GetEnvInt64("ATTACHMENT_MAX_BYTES", 5<<20)+(1<<20))
+}
+
+// Fungsi helper untuk memilih header respons yang disimpan dan diputar ulang, misalnya
+// Content-Type, ETag dan Location. Header yang dihitung ulang oleh server tidak disimpan.
+func replayableHeaders(header http.Header) http.Header {
+	stored := header.Clone()
+	for _, name := range []string{"Content-Length", "Date", "Idempotent-Replayed"} {
+		stored.Del(name)
+	}
+	return stored
+}
+
+func replayIdempotentResponse(w http.ResponseWriter, userID primitive.ObjectID, key, fingerprint string) {
+	var record models.IdempotencyKey
+	err := database.IdempotencyKeyCollection.FindOne(context.Background(), bson.M{"user_id": userID, "key": key}).Decode(&record)
+	if err != nil {
+		http.Error(w, "Error finding idempotency key", http.StatusInternalServerError)
+		return
+	}
+
+	if record.Fingerprint != fingerprint {
+		http.Error(w, "Idempotency-Key was already used with a different request", http.StatusUnprocessableEntity)
+		return
+	}
+	if !record.Completed {
+		http.Error(w, "A request with this Idempotency-Key is still being processed", http.StatusConflict)
+		return
+	}
+
+	for name, values := range record.Headers {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Attachment adalah metadata file struk yang dilampirkan ke transaksi.
+// Isi filenya disimpan di storage dengan key berupa hex dari ID.
+type Attachment struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TransactionID primitive.ObjectID `bson:"transaction_id" json:"transaction_id"`
+	UserID        primitive.ObjectID `bson:"user_id" json:"user_id"`
+	UploadedBy    primitive.ObjectID `bson:"uploaded_by" json:"uploaded_by"` // Kuota dihitung ke user ini
+	FileName      string             `bson:"file_name" json:"file_name"`
+	ContentType   string             `bson:"content_type" json:"content_type"`
+	Size          int64              `bson:"size" json:"size"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// AttachmentUsage adalah total ukuran lampiran yang diunggah satu user, dipakai untuk
+// memesan kuota secara atomik
+type AttachmentUsage struct {
+	UserID primitive.ObjectID `bson:"_id" json:"user_id"`
+	Bytes  int64              `bson:"bytes" json:"bytes"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// AuditLog adalah catatan perubahan (append-only) untuk transaksi dan kategori
+type AuditLog struct {
+	ID         primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID     `bson:"user_id" json:"user_id"`   // Pemilik dokumen
+	ActorID    primitive.ObjectID     `bson:"actor_id" json:"actor_id"` // User yang melakukan perubahan
+	Collection string                 `bson:"collection" json:"collection"`
+	DocumentID primitive.ObjectID     `bson:"document_id" json:"document_id"`
+	Operation  string                 `bson:"operation" json:"operation"` // "create", "update", "delete", "restore" atau "purge"
+	Timestamp  time.Time              `bson:"timestamp" json:"timestamp"`
+	Before     bson.M                 `bson:"before,omitempty" json:"before,omitempty"`
+	After      bson.M                 `bson:"after,omitempty" json:"after,omitempty"`
+	Changes    map[string]FieldChange `bson:"changes,omitempty" json:"changes,omitempty"`
+}
+
+type FieldChange struct {
+	Before interface{} `bson:"before" json:"before"`
+	After  interface{} `bson:"after" json:"after"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// BalanceSnapshot adalah total pemasukan dan pengeluaran user untuk satu periode seperti
+// yang dikembalikan API. Period bernilai "all" untuk total keseluruhan atau "YYYY-MM"
+// untuk total per bulan.
+type BalanceSnapshot struct {
+	Period       string    `json:"period"`
+	TotalIncome  float64   `json:"total_income"`
+	TotalExpense float64   `json:"total_expense"`
+	Count        int64     `json:"count"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// BalanceTotals adalah total satu bulan di dalam BalanceState
+type BalanceTotals struct {
+	TotalIncome  float64 `bson:"total_income"`
+	TotalExpense float64 `bson:"total_expense"`
+	Count        int64   `bson:"count"`
+}
+
+// BalanceWriter menandai penulisan transaksi yang sedang berjalan. Selama masih ada,
+// rebuild tidak menyimpan hasilnya.
+type BalanceWriter struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	StartedAt time.Time          `bson:"started_at"`
+}
+
+// BalanceState adalah snapshot saldo user: satu dokumen (period "all") berisi total
+// keseluruhan dan total per bulan, sehingga setiap delta dan setiap rebuild mengubah
+// keduanya secara atomik. Seq bertambah pada setiap delta dan Generation pada setiap
+// rebuild; Generation 0 berarti snapshot belum pernah dibangun.
+type BalanceState struct {
+	ID           primitive.ObjectID       `bson:"_id,omitempty"`
+	UserID       primitive.ObjectID       `bson:"user_id"`
+	Period       string                   `bson:"period"`
+	TotalIncome  float64                  `bson:"total_income"`
+	TotalExpense float64                  `bson:"total_expense"`
+	Count        int64                    `bson:"count"`
+	Months       map[string]BalanceTotals `bson:"months"`
+	Seq          int64                    `bson:"seq"`
+	Generation   int64                    `bson:"generation"`
+	Stale        bool                     `bson:"stale"` // Delta gagal diterapkan; bangun ulang saat dibaca
+	Writers      []BalanceWriter          `bson:"writers"`
+	UpdatedAt    time.Time                `bson:"updated_at"`
+}
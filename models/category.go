@@ -2,12 +2,14 @@ package models
 
 import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
 )
 
 type Category struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty"`
-	Name        string             `bson:"name"`
-	Description string             `bson:"description"`
-	Type        string             `bson:"type"`    // "income" atau "expense"
-	UserID      primitive.ObjectID `bson:"user_id"` // Tambahkan field ini jika diperlukan
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description" json:"description"`
+	Type        string             `bson:"type" json:"type"`       // "income" atau "expense"
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"` // Pemilik kategori
+	DeletedAt   *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
 }
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// CategoryRule mengisi kategori dan tag transaksi secara otomatis. Semua kondisi yang
+// diisi harus terpenuhi; aturan dievaluasi dari Priority terkecil dan aturan pertama
+// yang cocok dipakai.
+type CategoryRule struct {
+	ID                  primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID              primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Name                string             `bson:"name" json:"name"`
+	Priority            int                `bson:"priority" json:"priority"`
+	DescriptionContains string             `bson:"description_contains,omitempty" json:"description_contains,omitempty"` // Tidak membedakan huruf besar/kecil
+	DescriptionRegex    string             `bson:"description_regex,omitempty" json:"description_regex,omitempty"`
+	MinAmount           *float64           `bson:"min_amount,omitempty" json:"min_amount,omitempty"`
+	MaxAmount           *float64           `bson:"max_amount,omitempty" json:"max_amount,omitempty"`
+	Type                string             `bson:"type,omitempty" json:"type,omitempty"` // "income", "expense", atau kosong untuk keduanya
+	CategoryID          primitive.ObjectID `bson:"category_id,omitempty" json:"category_id,omitempty"`
+	Tags                []string           `bson:"tags,omitempty" json:"tags,omitempty"`
+	CreatedAt           time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// CategoryTemplate adalah daftar kategori bawaan yang disalin ke setiap user baru.
+// Satu dokumen per bahasa, dengan _id berisi kode bahasa ("id" atau "en").
+type CategoryTemplate struct {
+	Locale     string             `bson:"_id" json:"locale"`
+	Categories []TemplateCategory `bson:"categories" json:"categories"`
+}
+
+type TemplateCategory struct {
+	Name        string `bson:"name" json:"name"`
+	Description string `bson:"description" json:"description"`
+	Type        string `bson:"type" json:"type"` // "income" atau "expense"
+}
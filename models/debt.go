@@ -0,0 +1,33 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Debt mencatat hutang (Direction "payable", user berhutang ke Counterparty) atau piutang
+// (Direction "receivable", Counterparty berhutang ke user). Repaid adalah jumlah seluruh
+// Repayments dan SettledAt terisi saat hutang lunas.
+type Debt struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Counterparty string             `bson:"counterparty" json:"counterparty"`
+	Direction    string             `bson:"direction" json:"direction"` // "payable" (hutang) atau "receivable" (piutang)
+	Principal    float64            `bson:"principal" json:"principal"`
+	Description  string             `bson:"description,omitempty" json:"description,omitempty"`
+	DueDate      *time.Time         `bson:"due_date,omitempty" json:"due_date,omitempty"`
+	Repaid       float64            `bson:"repaid" json:"repaid"`
+	Repayments   []DebtRepayment    `bson:"repayments" json:"repayments"`
+	SettledAt    *time.Time         `bson:"settled_at,omitempty" json:"settled_at,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// DebtRepayment adalah satu pembayaran cicilan hutang atau piutang, opsional tertaut ke
+// transaksi pengeluaran (hutang) atau pemasukan (piutang)
+type DebtRepayment struct {
+	ID            primitive.ObjectID  `bson:"_id" json:"id"`
+	Amount        float64             `bson:"amount" json:"amount"`
+	Date          time.Time           `bson:"date" json:"date"`
+	TransactionID *primitive.ObjectID `bson:"transaction_id,omitempty" json:"transaction_id,omitempty"`
+	Note          string              `bson:"note,omitempty" json:"note,omitempty"`
+}
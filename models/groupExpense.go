@@ -0,0 +1,88 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// GroupExpense adalah pengeluaran patungan di ledger bersama: PaidBy membayar Amount dan
+// biayanya dibagi ke Shares. UserID adalah ID ledger bersama. Bagian PaidBy langsung
+// dicatat di ledger pribadinya, sedangkan bagian anggota lain dikirim sebagai GroupEntry
+// yang dikonfirmasi masing-masing anggota.
+type GroupExpense struct {
+	ID            primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID        primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	PaidBy        primitive.ObjectID  `bson:"paid_by" json:"paid_by"`
+	Description   string              `bson:"description" json:"description"`
+	Amount        float64             `bson:"amount" json:"amount"`
+	Date          time.Time           `bson:"date" json:"date"`
+	Method        string              `bson:"method" json:"method"` // "equal", "shares" atau "exact"
+	Shares        []GroupExpenseShare `bson:"shares" json:"shares"`
+	TransactionID *primitive.ObjectID `bson:"transaction_id,omitempty" json:"transaction_id,omitempty"` // Bagian PaidBy di ledger pribadinya
+	CreatedBy     primitive.ObjectID  `bson:"created_by" json:"created_by"`
+	CreatedAt     time.Time           `bson:"created_at" json:"created_at"`
+	DeletedAt     *time.Time          `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+}
+
+// GroupExpenseShare adalah bagian satu anggota. Weight hanya dipakai pada metode "shares";
+// Amount adalah bagian akhir yang harus ditanggung anggota.
+type GroupExpenseShare struct {
+	UserID   primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Username string             `bson:"username" json:"username"`
+	Weight   float64            `bson:"weight,omitempty" json:"weight,omitempty"`
+	Amount   float64            `bson:"amount" json:"amount"`
+}
+
+// GroupSettlement mencatat pembayaran dari FromUserID ke ToUserID untuk melunasi
+// patungan. Pengirim langsung mencatat pengeluaran di ledger pribadinya
+// (FromTransactionID), sedangkan penerima mendapat GroupEntry pemasukan yang menjadi
+// ToTransactionID setelah dikonfirmasi.
+type GroupSettlement struct {
+	ID                primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID            primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	FromUserID        primitive.ObjectID  `bson:"from_user_id" json:"from_user_id"`
+	ToUserID          primitive.ObjectID  `bson:"to_user_id" json:"to_user_id"`
+	Amount            float64             `bson:"amount" json:"amount"`
+	Date              time.Time           `bson:"date" json:"date"`
+	FromTransactionID *primitive.ObjectID `bson:"from_transaction_id,omitempty" json:"from_transaction_id,omitempty"`
+	ToTransactionID   *primitive.ObjectID `bson:"to_transaction_id,omitempty" json:"to_transaction_id,omitempty"`
+	CreatedBy         primitive.ObjectID  `bson:"created_by" json:"created_by"`
+	CreatedAt         time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// GroupEntry adalah bagian patungan atau pelunasan yang diterima untuk satu anggota dan
+// menunggu konfirmasi. Entri tidak mengubah ledger pribadi anggota sampai anggota itu
+// sendiri mengonfirmasinya; konfirmasi membuat transaksi bertipe Type di ledger pribadinya.
+type GroupEntry struct {
+	ID                primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID            primitive.ObjectID  `bson:"user_id" json:"user_id"`     // Anggota pemilik bagian
+	LedgerID          primitive.ObjectID  `bson:"ledger_id" json:"ledger_id"` // Ledger bersama asal patungan
+	GroupExpenseID    primitive.ObjectID  `bson:"group_expense_id,omitempty" json:"group_expense_id"`
+	GroupSettlementID *primitive.ObjectID `bson:"group_settlement_id,omitempty" json:"group_settlement_id,omitempty"`
+	Type              string              `bson:"type" json:"type"` // "expense" (bagian patungan) atau "income" (pelunasan yang diterima)
+	Amount            float64             `bson:"amount" json:"amount"`
+	Description       string              `bson:"description" json:"description"`
+	Date              time.Time           `bson:"date" json:"date"`
+	Status            string              `bson:"status" json:"status"` // "pending", "confirmed", "rejected" atau "cancelled"
+	TransactionID     *primitive.ObjectID `bson:"transaction_id,omitempty" json:"transaction_id,omitempty"`
+	CreatedBy         primitive.ObjectID  `bson:"created_by" json:"created_by"`
+	CreatedAt         time.Time           `bson:"created_at" json:"created_at"`
+	ResolvedAt        *time.Time          `bson:"resolved_at,omitempty" json:"resolved_at,omitempty"`
+}
+
+// GroupPosition menyimpan posisi semua anggota satu ledger bersama (ID sama dengan ID
+// ledger) dalam satuan sen. Posisi diperbarui dengan $inc setiap patungan dan pelunasan
+// ditulis, sehingga batas pelunasan bisa dicek secara atomik di filter update.
+type GroupPosition struct {
+	ID      primitive.ObjectID             `bson:"_id" json:"id"`
+	Members map[string]GroupMemberPosition `bson:"members" json:"members"` // Key: ID user dalam hex
+}
+
+// GroupMemberPosition adalah posisi satu anggota: Net positif berarti anggota masih harus
+// menerima uang, negatif berarti masih berhutang
+type GroupMemberPosition struct {
+	Username string `bson:"username" json:"username"`
+	Paid     int64  `bson:"paid" json:"paid"`
+	Owed     int64  `bson:"owed" json:"owed"`
+	Net      int64  `bson:"net" json:"net"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// IdempotencyKey menyimpan respons pertama dari request dengan header Idempotency-Key
+// agar request ulang dengan key yang sama mendapat respons yang sama
+type IdempotencyKey struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty"`
+	UserID      primitive.ObjectID  `bson:"user_id"`
+	Key         string              `bson:"key"`
+	Fingerprint string              `bson:"fingerprint"` // Hash dari method, path dan body request
+	Completed   bool                `bson:"completed"`
+	StatusCode  int                 `bson:"status_code,omitempty"`
+	Headers     map[string][]string `bson:"headers,omitempty"`
+	Body        []byte              `bson:"body,omitempty"`
+	CreatedAt   time.Time           `bson:"created_at"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// InstallmentPlan adalah pembelian yang dibayar dengan cicilan bulanan. Bunga dihitung
+// flat per bulan dari pokok dan biaya admin ditagihkan bersama cicilan pertama. Setiap
+// cicilan dicatat sebagai transaksi pengeluaran saat jatuh tempo.
+type InstallmentPlan struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID       primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	Description  string              `bson:"description" json:"description"`
+	CategoryID   primitive.ObjectID  `bson:"category_id" json:"category_id"`
+	PayeeID      *primitive.ObjectID `bson:"payee_id,omitempty" json:"payee_id,omitempty"`
+	Principal    float64             `bson:"principal" json:"principal"`
+	Months       int                 `bson:"months" json:"months"`
+	InterestRate float64             `bson:"interest_rate" json:"interest_rate"` // Persen flat per bulan
+	AdminFee     float64             `bson:"admin_fee" json:"admin_fee"`
+	StartDate    time.Time           `bson:"start_date" json:"start_date"` // Jatuh tempo cicilan pertama
+	Total        float64             `bson:"total" json:"total"`
+	Status       string              `bson:"status" json:"status"` // "active", "completed", "paid_off" atau "cancelled"
+	Installments []Installment       `bson:"installments" json:"installments"`
+	CreatedAt    time.Time           `bson:"created_at" json:"created_at"`
+
+	// Sisa kewajiban dari cicilan yang belum dicatat, dihitung saat dibaca
+	Remaining float64 `bson:"-" json:"remaining"`
+}
+
+type Installment struct {
+	Number        int                 `bson:"number" json:"number"`
+	DueDate       time.Time           `bson:"due_date" json:"due_date"`
+	Principal     float64             `bson:"principal" json:"principal"`
+	Interest      float64             `bson:"interest" json:"interest"`
+	Fee           float64             `bson:"fee" json:"fee"`
+	Amount        float64             `bson:"amount" json:"amount"`
+	Status        string              `bson:"status" json:"status"` // "scheduled", "posted" atau "waived"
+	TransactionID *primitive.ObjectID `bson:"transaction_id,omitempty" json:"transaction_id,omitempty"`
+}
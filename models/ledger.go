@@ -0,0 +1,29 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Ledger adalah buku keuangan bersama. Data ledger (transaksi, kategori, payee, dan
+// seterusnya) disimpan dengan user_id = ID ledger. Setiap user juga memiliki ledger
+// pribadi yang tidak disimpan di koleksi ini dan memakai ID user itu sendiri.
+type Ledger struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	OwnerID   primitive.ObjectID `bson:"owner_id" json:"owner_id"`
+	Members   []LedgerMember     `bson:"members" json:"members"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	DeletedAt *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+}
+
+// LedgerMember adalah anggota ledger. Undangan disimpan sebagai anggota dengan Status
+// "invited" sampai diterima oleh user yang diundang.
+type LedgerMember struct {
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Username  string             `bson:"username" json:"username"`
+	Role      string             `bson:"role" json:"role"`     // "owner", "editor" atau "viewer"
+	Status    string             `bson:"status" json:"status"` // "invited" atau "active"
+	InvitedBy primitive.ObjectID `bson:"invited_by,omitempty" json:"invited_by,omitempty"`
+	JoinedAt  *time.Time         `bson:"joined_at,omitempty" json:"joined_at,omitempty"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// PasswordResetToken disimpan sebagai hash SHA-256 seperti refresh token. Token hanya bisa
+// dipakai sekali (UsedAt) sebelum ExpiresAt; dokumen yang kedaluwarsa dihapus otomatis.
+type PasswordResetToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	TokenHash string             `bson:"token_hash"`
+	CreatedAt time.Time          `bson:"created_at"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	UsedAt    *time.Time         `bson:"used_at,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Payee adalah penerima atau pemberi dana (merchant, toko, kantor). Aliases berisi nama
+// mentah yang sudah dinormalisasi, misalnya "grab food" untuk deskripsi "GRAB*FOOD 123",
+// dan dipakai untuk menautkan transaksi baru secara otomatis.
+type Payee struct {
+	ID                primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID            primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	Name              string              `bson:"name" json:"name"`
+	NormalizedName    string              `bson:"normalized_name" json:"-"`
+	Aliases           []string            `bson:"aliases,omitempty" json:"aliases,omitempty"`
+	DefaultCategoryID *primitive.ObjectID `bson:"default_category_id,omitempty" json:"default_category_id,omitempty"`
+	CreatedAt         time.Time           `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// RefreshToken disimpan sebagai hash SHA-256, tidak pernah dalam bentuk aslinya. Setiap
+// login memulai satu keluarga token (FamilyID, juga dipakai sebagai ID sesi di access
+// token); setiap refresh menandai token lama dengan UsedAt dan menerbitkan token baru di
+// keluarga yang sama.
+type RefreshToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	FamilyID  primitive.ObjectID `bson:"family_id"`
+	TokenHash string             `bson:"token_hash"`
+	CreatedAt time.Time          `bson:"created_at"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	UsedAt    *time.Time         `bson:"used_at,omitempty"`
+	RevokedAt *time.Time         `bson:"revoked_at,omitempty"`
+}
+
+// RevokedSession adalah daftar sesi yang dicabut (logout atau penggunaan ulang refresh
+// token). Access token dengan ID sesi ini ditolak sampai ExpiresAt, setelah itu semua
+// access token sesi tersebut sudah kedaluwarsa dan dokumen dihapus otomatis.
+type RevokedSession struct {
+	ID        primitive.ObjectID `bson:"_id"` // FamilyID refresh token
+	UserID    primitive.ObjectID `bson:"user_id"`
+	RevokedAt time.Time          `bson:"revoked_at"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+}
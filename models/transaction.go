@@ -6,11 +6,41 @@ import (
 )
 
 type Transaction struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty"`
-	Type        string             `bson:"type"` // "income" atau "expense"
-	CategoryID  primitive.ObjectID `bson:"category_id"`
-	Amount      float64            `bson:"amount"`
-	Description string             `bson:"description"`
-	Date        time.Time          `bson:"date"`
-	UserID      primitive.ObjectID `bson:"user_id"`
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Type        string              `bson:"type" json:"type"` // "income" atau "expense"
+	CategoryID  primitive.ObjectID  `bson:"category_id" json:"category_id"`
+	Amount      float64             `bson:"amount" json:"amount"`
+	Description string              `bson:"description" json:"description"`
+	Date        time.Time           `bson:"date" json:"date"`
+	UserID      primitive.ObjectID  `bson:"user_id" json:"user_id"` // ID ledger pemilik (ID user untuk ledger pribadi)
+	Tags        []string            `bson:"tags,omitempty" json:"tags,omitempty"`
+	Splits      []TransactionSplit  `bson:"splits,omitempty" json:"splits,omitempty"`
+	PayeeID     *primitive.ObjectID `bson:"payee_id,omitempty" json:"payee_id,omitempty"`
+	DebtID      *primitive.ObjectID `bson:"debt_id,omitempty" json:"debt_id,omitempty"`       // Diisi jika transaksi adalah pembayaran hutang/piutang
+	CreatedBy   *primitive.ObjectID `bson:"created_by,omitempty" json:"created_by,omitempty"` // User yang mencatat transaksi
+
+	// Diisi jika transaksi adalah cicilan dari rencana cicilan
+	InstallmentPlanID *primitive.ObjectID `bson:"installment_plan_id,omitempty" json:"installment_plan_id,omitempty"`
+	InstallmentNumber int                 `bson:"installment_number,omitempty" json:"installment_number,omitempty"`
+	Version           int64               `bson:"version" json:"version"` // Naik setiap kali transaksi ditulis, dipakai sebagai ETag
+
+	// ID penulisan batch best_effort terakhir, untuk mengetahui item BulkWrite mana yang
+	// benar-benar menulis dokumen ini
+	WriteID *primitive.ObjectID `bson:"write_id,omitempty" json:"-"`
+
+	// Soft delete: transaksi di tempat sampah memiliki DeletedAt. DeletedWith berisi
+	// ID kategori jika transaksi ikut terhapus karena kategori dihapus dengan cascade.
+	DeletedAt   *time.Time          `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	DeletedWith *primitive.ObjectID `bson:"deleted_with,omitempty" json:"deleted_with,omitempty"`
+
+	// Saldo setelah transaksi ini, hanya diisi pada GET /transactions?running_balance=true
+	RunningBalance *float64 `bson:"-" json:"running_balance,omitempty"`
+}
+
+// TransactionSplit adalah satu baris rincian transaksi yang dibagi ke beberapa kategori.
+// Jumlah seluruh baris harus sama dengan Amount transaksi induknya.
+type TransactionSplit struct {
+	CategoryID primitive.ObjectID `bson:"category_id" json:"category_id"`
+	Amount     float64            `bson:"amount" json:"amount"`
+	Memo       string             `bson:"memo,omitempty" json:"memo,omitempty"`
 }
@@ -8,4 +8,12 @@ type User struct {
 	ID       primitive.ObjectID `bson:"_id,omitempty"`
 	Username string             `bson:"username"`
 	Password string             `bson:"password"`
+	Email    string             `bson:"email,omitempty"`    // Tujuan token reset password
+	Locale   string             `bson:"locale,omitempty"`   // "id" atau "en"
+	Role     string             `bson:"role,omitempty"`     // "admin" untuk administrator
+	Timezone string             `bson:"timezone,omitempty"` // Nama zona IANA, misalnya "Asia/Jakarta"
+
+	// Versi token dinaikkan setiap logout dari semua perangkat; access token dengan versi
+	// lain ditolak
+	TokenVersion int64 `bson:"token_version,omitempty" json:"-"`
 }
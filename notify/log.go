@@ -0,0 +1,15 @@
+package notify
+
+import (
+	"context"
+	"log"
+)
+
+// LogNotifier menulis pesan ke log server. Cocok untuk development karena tidak butuh
+// server email.
+type LogNotifier struct{}
+
+func (LogNotifier) Send(ctx context.Context, msg Message) error {
+	log.Printf("Notification to %q: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
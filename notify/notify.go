@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"finance-app/config"
+)
+
+// Message adalah pesan yang dikirim ke user, misalnya token reset password
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier mengirim pesan ke user
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Users adalah notifier yang dipakai untuk pesan akun seperti reset password
+var Users Notifier
+
+// Init memilih implementasi notifier dari NOTIFIER ("log" atau "smtp")
+func Init() error {
+	switch backend := config.GetEnv("NOTIFIER", "log"); backend {
+	case "log":
+		Users = LogNotifier{}
+	case "smtp":
+		n, err := NewSMTPNotifier(
+			config.GetEnv("SMTP_HOST", "localhost"),
+			config.GetEnvInt64("SMTP_PORT", 1025),
+			config.GetEnv("SMTP_USERNAME", ""),
+			config.GetEnv("SMTP_PASSWORD", ""),
+			config.GetEnv("SMTP_FROM", ""),
+		)
+		if err != nil {
+			return err
+		}
+		Users = n
+	default:
+		return fmt.Errorf("unknown NOTIFIER %q", backend)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+var errMissingRecipient = errors.New("recipient has no email address")
+
+// SMTPNotifier mengirim pesan sebagai email lewat server SMTP. Tanpa username tidak ada
+// autentikasi, sehingga bisa dipakai dengan server email uji lokal seperti MailHog.
+type SMTPNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPNotifier(host string, port int64, username, password, from string) (*SMTPNotifier, error) {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP_FROM %q: %v", from, err)
+	}
+	n := &SMTPNotifier{
+		addr: net.JoinHostPort(host, strconv.FormatInt(port, 10)),
+		from: sender.Address,
+	}
+	if username != "" {
+		n.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return n, nil
+}
+
+func (n *SMTPNotifier) Send(ctx context.Context, msg Message) error {
+	if msg.To == "" {
+		return errMissingRecipient
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	// Header tidak boleh berisi baris baru agar tidak bisa disisipi header lain
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(msg.Subject)
+	body := "From: " + n.from + "\r\n" +
+		"To: " + to.Address + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		strings.ReplaceAll(msg.Body, "\n", "\r\n")
+	return smtp.SendMail(n.addr, n.auth, n.from, []string{to.Address}, []byte(body))
+}
@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"finance-app/controllers"
+	"finance-app/middleware"
+	"github.com/gorilla/mux"
+)
+
+func SetupRouter() *mux.Router {
+	r := mux.NewRouter()
+
+	// Endpoint untuk Autentikasi
+	r.HandleFunc("/auth/register", controllers.RegisterUser).Methods("POST")
+	r.HandleFunc("/auth/login", controllers.LoginUser).Methods("POST")
+	r.HandleFunc("/auth/refresh", controllers.RefreshSession).Methods("POST")
+	r.HandleFunc("/auth/password/forgot", controllers.RequestPasswordReset).Methods("POST")
+	r.HandleFunc("/auth/password/reset", controllers.ResetPassword).Methods("POST")
+	r.HandleFunc("/.well-known/jwks.json", controllers.GetJWKS).Methods("GET")
+
+	// Endpoint di bawah ini membutuhkan token JWT
+	api := r.PathPrefix("/").Subrouter()
+	api.Use(middleware.AuthMiddleware())
+	api.Use(middleware.IdempotencyMiddleware())
+
+	// Endpoint untuk Sesi
+	api.HandleFunc("/auth/logout", controllers.Logout).Methods("POST")
+	api.HandleFunc("/auth/logout-all", controllers.LogoutAll).Methods("POST")
+	api.HandleFunc("/auth/password", controllers.ChangePassword).Methods("POST")
+
+	// Endpoint untuk Kategori
+	api.HandleFunc("/categories", controllers.CreateCategory).Methods("POST")
+	api.HandleFunc("/categories", controllers.GetCategories).Methods("GET")
+	api.HandleFunc("/categories/suggest", controllers.SuggestCategories).Methods("GET")
+	api.HandleFunc("/categories/{id}", controllers.UpdateCategory).Methods("PUT")
+	api.HandleFunc("/categories/{id}", controllers.DeleteCategory).Methods("DELETE")
+	api.HandleFunc("/categories/{id}/history", controllers.GetDocumentHistory("categories")).Methods("GET")
+
+	// Endpoint untuk Transaksi
+	api.HandleFunc("/transactions", controllers.CreateTransaction).Methods("POST")
+	api.HandleFunc("/transactions", controllers.GetTransactions).Methods("GET")
+	api.HandleFunc("/transactions/batch", controllers.BatchTransactions).Methods("POST")
+	api.HandleFunc("/transactions/import", controllers.ImportTransactions).Methods("POST")
+	api.HandleFunc("/transactions/import/preview", controllers.PreviewImport).Methods("POST")
+	api.HandleFunc("/transactions/{id}", controllers.GetTransaction).Methods("GET")
+	api.HandleFunc("/transactions/{id}", controllers.UpdateTransaction).Methods("PUT")
+	api.HandleFunc("/transactions/{id}", controllers.DeleteTransaction).Methods("DELETE")
+	api.HandleFunc("/transactions/{id}/history", controllers.GetDocumentHistory("transactions")).Methods("GET")
+
+	// Endpoint untuk Aturan Kategori Otomatis
+	api.HandleFunc("/rules", controllers.CreateRule).Methods("POST")
+	api.HandleFunc("/rules", controllers.GetRules).Methods("GET")
+	api.HandleFunc("/rules/test", controllers.TestRule).Methods("POST")
+	api.HandleFunc("/rules/apply", controllers.ApplyRules).Methods("POST")
+	api.HandleFunc("/rules/{id}", controllers.UpdateRule).Methods("PUT")
+	api.HandleFunc("/rules/{id}", controllers.DeleteRule).Methods("DELETE")
+
+	// Endpoint untuk Payee
+	api.HandleFunc("/payees", controllers.CreatePayee).Methods("POST")
+	api.HandleFunc("/payees", controllers.GetPayees).Methods("GET")
+	api.HandleFunc("/payees/{id}", controllers.UpdatePayee).Methods("PUT")
+	api.HandleFunc("/payees/{id}", controllers.DeletePayee).Methods("DELETE")
+	api.HandleFunc("/payees/{id}/merge", controllers.MergePayees).Methods("POST")
+
+	// Endpoint untuk Hutang dan Piutang
+	api.HandleFunc("/debts", controllers.CreateDebt).Methods("POST")
+	api.HandleFunc("/debts", controllers.GetDebts).Methods("GET")
+	api.HandleFunc("/debts/summary", controllers.GetDebtSummary).Methods("GET")
+	api.HandleFunc("/debts/overdue", controllers.GetOverdueDebts).Methods("GET")
+	api.HandleFunc("/debts/{id}", controllers.GetDebt).Methods("GET")
+	api.HandleFunc("/debts/{id}", controllers.UpdateDebt).Methods("PUT")
+	api.HandleFunc("/debts/{id}", controllers.DeleteDebt).Methods("DELETE")
+	api.HandleFunc("/debts/{id}/repayments", controllers.AddDebtRepayment).Methods("POST")
+	api.HandleFunc("/debts/{id}/repayments/{repayment_id}", controllers.DeleteDebtRepayment).Methods("DELETE")
+
+	// Endpoint untuk Cicilan
+	api.HandleFunc("/installments", controllers.CreateInstallmentPlan).Methods("POST")
+	api.HandleFunc("/installments", controllers.GetInstallmentPlans).Methods("GET")
+	api.HandleFunc("/installments/{id}", controllers.GetInstallmentPlan).Methods("GET")
+	api.HandleFunc("/installments/{id}", controllers.CancelInstallmentPlan).Methods("DELETE")
+	api.HandleFunc("/installments/{id}/payoff", controllers.PayOffInstallmentPlan).Methods("POST")
+
+	// Endpoint untuk Ledger Bersama
+	api.HandleFunc("/ledgers", controllers.CreateLedger).Methods("POST")
+	api.HandleFunc("/ledgers", controllers.GetLedgers).Methods("GET")
+	api.HandleFunc("/ledgers/{id}", controllers.GetLedger).Methods("GET")
+	api.HandleFunc("/ledgers/{id}", controllers.UpdateLedger).Methods("PUT")
+	api.HandleFunc("/ledgers/{id}", controllers.DeleteLedger).Methods("DELETE")
+	api.HandleFunc("/ledgers/{id}/accept", controllers.AcceptLedgerInvitation).Methods("POST")
+	api.HandleFunc("/ledgers/{id}/members", controllers.InviteLedgerMember).Methods("POST")
+	api.HandleFunc("/ledgers/{id}/members/{user_id}", controllers.UpdateLedgerMember).Methods("PUT")
+	api.HandleFunc("/ledgers/{id}/members/{user_id}", controllers.RemoveLedgerMember).Methods("DELETE")
+
+	// Endpoint untuk Patungan di Ledger Bersama
+	api.HandleFunc("/group-expenses", controllers.CreateGroupExpense).Methods("POST")
+	api.HandleFunc("/group-expenses", controllers.GetGroupExpenses).Methods("GET")
+	api.HandleFunc("/group-expenses/balances", controllers.GetGroupBalances).Methods("GET")
+	api.HandleFunc("/group-expenses/settlements", controllers.CreateGroupSettlement).Methods("POST")
+	api.HandleFunc("/group-expenses/settlements", controllers.GetGroupSettlements).Methods("GET")
+	api.HandleFunc("/group-expenses/entries", controllers.GetGroupEntries).Methods("GET")
+	api.HandleFunc("/group-expenses/entries/{id}/confirm", controllers.ConfirmGroupEntry).Methods("POST")
+	api.HandleFunc("/group-expenses/entries/{id}/reject", controllers.RejectGroupEntry).Methods("POST")
+	api.HandleFunc("/group-expenses/{id}", controllers.DeleteGroupExpense).Methods("DELETE")
+
+	// Endpoint untuk Lampiran Struk
+	api.HandleFunc("/transactions/{id}/attachments", controllers.UploadAttachment).Methods("POST")
+	api.HandleFunc("/transactions/{id}/attachments", controllers.GetAttachments).Methods("GET")
+	api.HandleFunc("/attachments/{id}", controllers.DownloadAttachment).Methods("GET")
+	api.HandleFunc("/attachments/{id}", controllers.DeleteAttachment).Methods("DELETE")
+
+	// Endpoint untuk Tag dan Laporan
+	api.HandleFunc("/tags", controllers.GetTags).Methods("GET")
+	api.HandleFunc("/reports/tags", controllers.GetTagReport).Methods("GET")
+	api.HandleFunc("/reports/categories", controllers.GetCategoryReport).Methods("GET")
+	api.HandleFunc("/reports/payees", controllers.GetPayeeReport).Methods("GET")
+	api.HandleFunc("/reports/members", controllers.GetMemberReport).Methods("GET")
+
+	// Endpoint untuk Tempat Sampah
+	api.HandleFunc("/trash", controllers.GetTrash).Methods("GET")
+	api.HandleFunc("/trash/{id}/restore", controllers.RestoreFromTrash).Methods("POST")
+
+	// Endpoint untuk Riwayat Perubahan
+	api.HandleFunc("/audit", controllers.GetAuditLogs).Methods("GET")
+
+	// Endpoint untuk Saldo dan Beranda
+	api.HandleFunc("/stats/timeseries", controllers.GetTimeSeries).Methods("GET")
+	api.HandleFunc("/balance", controllers.GetCurrentBalance).Methods("GET")
+	api.HandleFunc("/balance/months", controllers.GetMonthlyBalances).Methods("GET")
+	api.HandleFunc("/home", controllers.GetHomeData).Methods("GET")
+
+	// Endpoint khusus admin
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.AdminMiddleware())
+	admin.HandleFunc("/category-templates/{locale}", controllers.GetCategoryTemplate).Methods("GET")
+	admin.HandleFunc("/category-templates/{locale}", controllers.UpdateCategoryTemplate).Methods("PUT")
+
+	return r
+}
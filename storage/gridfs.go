@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GridFSStorage menyimpan file di bucket GridFS pada database MongoDB yang sama.
+// Key harus berupa hex ObjectID dan dipakai sebagai _id file di GridFS.
+type GridFSStorage struct {
+	bucket *gridfs.Bucket
+}
+
+func NewGridFSStorage(db *mongo.Database, bucketName string) (*GridFSStorage, error) {
+	bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName(bucketName))
+	if err != nil {
+		return nil, err
+	}
+	return &GridFSStorage{bucket: bucket}, nil
+}
+
+func (s *GridFSStorage) Save(ctx context.Context, key, filename string, content io.Reader) error {
+	fileID, err := primitive.ObjectIDFromHex(key)
+	if err != nil {
+		return err
+	}
+	return s.bucket.UploadFromStreamWithID(fileID, filename, content)
+}
+
+func (s *GridFSStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	fileID, err := primitive.ObjectIDFromHex(key)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	stream, err := s.bucket.OpenDownloadStream(fileID)
+	if err == gridfs.ErrFileNotFound {
+		return nil, ErrNotFound
+	}
+	return stream, err
+}
+
+func (s *GridFSStorage) Delete(ctx context.Context, key string) error {
+	fileID, err := primitive.ObjectIDFromHex(key)
+	if err != nil {
+		return ErrNotFound
+	}
+	err = s.bucket.DeleteContext(ctx, fileID)
+	if err == gridfs.ErrFileNotFound {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"finance-app/config"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrNotFound = errors.New("file not found")
+
+// Storage menyimpan isi file lampiran berdasarkan key yang unik
+type Storage interface {
+	Save(ctx context.Context, key, filename string, content io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Attachments adalah storage yang dipakai untuk lampiran struk transaksi
+var Attachments Storage
+
+// Init memilih implementasi storage dari ATTACHMENT_STORAGE ("gridfs" atau "local")
+func Init(client *mongo.Client) error {
+	switch backend := config.GetEnv("ATTACHMENT_STORAGE", "gridfs"); backend {
+	case "gridfs":
+		s, err := NewGridFSStorage(client.Database("finance_app"), "receipts")
+		if err != nil {
+			return err
+		}
+		Attachments = s
+	case "local":
+		s, err := NewLocalStorage(config.GetEnv("ATTACHMENT_DIR", "uploads"))
+		if err != nil {
+			return err
+		}
+		Attachments = s
+	default:
+		return fmt.Errorf("unknown ATTACHMENT_STORAGE %q", backend)
+	}
+	return nil
+}
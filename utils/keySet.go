@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"finance-app/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	errKeySetNotLoaded     = errors.New("JWT key set is not loaded")
+	errUnknownSigningKey   = errors.New("Token is signed with an unknown key")
+	errUnexpectedAlgorithm = errors.New("Token algorithm does not match its key")
+	errUnsupportedKey      = errors.New("Unsupported key. Use an RSA key or an EC key on the P-256 curve")
+)
+
+// signingKey adalah satu kunci di key set. Untuk HS256 kunci penandatangan dan
+// pemverifikasi sama (secret); untuk RS256/ES256 kunci publik dipakai untuk verifikasi dan
+// diterbitkan di JWKS.
+type signingKey struct {
+	id        string
+	algorithm string
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// keySet berisi satu kunci aktif untuk menandatangani token dan semua kunci yang masih
+// diterima untuk verifikasi (kunci aktif dan kunci lama selama masa rotasi)
+type keySet struct {
+	active *signingKey
+	byID   map[string]*signingKey
+	order  []string
+}
+
+var keys *keySet
+
+// LoadKeySet memuat kunci JWT dari environment:
+//   - JWT_SIGNING_KEY: path PEM kunci privat RSA (RS256) atau EC P-256 (ES256) untuk
+//     menandatangani token, dengan kid dari JWT_SIGNING_KID (default "default").
+//   - JWT_VERIFY_KEYS: daftar "kid=path" dipisahkan koma berisi kunci publik (atau privat)
+//     lama yang masih diterima selama rotasi.
+//
+// Tanpa JWT_SIGNING_KEY, token ditandatangani HS256 dengan JWT_SECRET.
+func LoadKeySet() error {
+	set := &keySet{byID: make(map[string]*signingKey)}
+
+	if path := config.GetEnv("JWT_SIGNING_KEY", ""); path != "" {
+		key, err := loadPEMKey(config.GetEnv("JWT_SIGNING_KID", "default"), path)
+		if err != nil {
+			return err
+		}
+		if key.signKey == nil {
+			return fmt.Errorf("JWT_SIGNING_KEY %s must be a private key", path)
+		}
+		set.add(key)
+		set.active = key
+	} else {
+		secret := []byte(config.GetEnv("JWT_SECRET", "test2"))
+		key := &signingKey{id: config.GetEnv("JWT_SIGNING_KID", "hs-default"), algorithm: "HS256", signKey: secret, verifyKey: secret}
+		set.add(key)
+		set.active = key
+	}
+
+	for _, entry := range strings.Split(config.GetEnv("JWT_VERIFY_KEYS", ""), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, path, ok := strings.Cut(entry, "=")
+		if !ok || kid == "" || path == "" {
+			return fmt.Errorf("invalid JWT_VERIFY_KEYS entry %q, expected kid=path", entry)
+		}
+		if _, exists := set.byID[kid]; exists {
+			return fmt.Errorf("duplicate JWT key id %q", kid)
+		}
+		key, err := loadPEMKey(kid, path)
+		if err != nil {
+			return err
+		}
+		set.add(key)
+	}
+
+	keys = set
+	return nil
+}
+
+func (s *keySet) add(key *signingKey) {
+	s.byID[key.id] = key
+	s.order = append(s.order, key.id)
+}
+
+// Fungsi helper untuk kunci verifikasi token. Algoritma dikunci ke algoritma kunci
+// berdasarkan kid, sehingga token dengan alg lain (termasuk "none" atau HS256 yang
+// ditandatangani dengan kunci publik) ditolak.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if keys == nil {
+		return nil, errKeySetNotLoaded
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, ok := keys.byID[kid]
+	if !ok {
+		return nil, errUnknownSigningKey
+	}
+	if token.Method == nil || token.Method.Alg() != key.algorithm {
+		return nil, errUnexpectedAlgorithm
+	}
+	return key.verifyKey, nil
+}
+
+// Fungsi helper untuk membaca kunci PEM. Kunci privat juga menyediakan kunci publiknya
+// sehingga bisa dipakai untuk menandatangani maupun memverifikasi.
+func loadPEMKey(kid, path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM block", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	key := &signingKey{id: kid}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.algorithm, key.signKey, key.verifyKey = "RS256", k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.algorithm, key.verifyKey = "RS256", k
+	case *ecdsa.PrivateKey:
+		key.algorithm, key.signKey, key.verifyKey = "ES256", k, &k.PublicKey
+	case *ecdsa.PublicKey:
+		key.algorithm, key.verifyKey = "ES256", k
+	default:
+		return nil, fmt.Errorf("%s: %v", path, errUnsupportedKey)
+	}
+	if key.algorithm == "ES256" && key.verifyKey.(*ecdsa.PublicKey).Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%s: %v", path, errUnsupportedKey)
+	}
+	return key, nil
+}
+
+// JWKS mengembalikan kunci publik key set dalam format JSON Web Key Set. Secret HS256
+// tidak pernah diterbitkan.
+func JWKS() map[string]interface{} {
+	jwks := []map[string]string{}
+	if keys == nil {
+		return map[string]interface{}{"keys": jwks}
+	}
+	for _, kid := range keys.order {
+		key := keys.byID[kid]
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "RSA",
+				"kid": key.id,
+				"use": "sig",
+				"alg": key.algorithm,
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "EC",
+				"kid": key.id,
+				"use": "sig",
+				"alg": key.algorithm,
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+				"y":   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+			})
+		}
+	}
+	return map[string]interface{}{"keys": jwks}
+}
@@ -1,27 +1,134 @@
 package utils
 
 import (
-	"github.com/dgrijalva/jwt-go"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"finance-app/config"
+	"github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"time"
 )
 
-var jwtSecret = []byte("test2")
+// Toleransi selisih jam antar server saat memeriksa exp, nbf dan iat
+const tokenLeeway = 30 * time.Second
 
-func GenerateToken(userID primitive.ObjectID) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(), // Token berlaku selama 24 jam
+var errMissingTokenClaims = errors.New("Token is missing required claims")
+
+// AccessClaims adalah isi access token. Sid adalah ID sesi (keluarga refresh token) dan ver
+// adalah versi token user saat token diterbitkan.
+type AccessClaims struct {
+	UserID       string `json:"user_id"`
+	SessionID    string `json:"sid"`
+	TokenVersion int64  `json:"ver"`
+	jwt.RegisteredClaims
+}
+
+// TokenIssuer adalah nilai iss yang diterbitkan dan diwajibkan pada access token
+func TokenIssuer() string {
+	return config.GetEnv("JWT_ISSUER", "finance-app")
+}
+
+// TokenAudience adalah nilai aud yang diterbitkan dan diwajibkan pada access token
+func TokenAudience() string {
+	return config.GetEnv("JWT_AUDIENCE", "finance-app-api")
+}
+
+// AccessTokenTTL adalah masa berlaku access token (default 15 menit)
+func AccessTokenTTL() time.Duration {
+	return time.Duration(config.GetEnvInt64("ACCESS_TOKEN_TTL_MINUTES", 15)) * time.Minute
+}
+
+// AccessTokenMaxAge adalah batas waktu access token masih bisa diterima ValidateToken,
+// yaitu masa berlakunya ditambah toleransi selisih jam
+func AccessTokenMaxAge() time.Duration {
+	return AccessTokenTTL() + tokenLeeway
+}
+
+// RefreshTokenTTL adalah masa berlaku satu refresh token (default 30 hari)
+func RefreshTokenTTL() time.Duration {
+	return time.Duration(config.GetEnvInt64("REFRESH_TOKEN_TTL_DAYS", 30)) * 24 * time.Hour
+}
+
+// PasswordResetTTL adalah masa berlaku token reset password (default 30 menit)
+func PasswordResetTTL() time.Duration {
+	return time.Duration(config.GetEnvInt64("PASSWORD_RESET_TTL_MINUTES", 30)) * time.Minute
+}
+
+// GenerateToken menerbitkan access token untuk sesi sessionID milik user dengan versi token
+// user saat ini, ditandatangani dengan kunci aktif key set dan kid-nya di header
+func GenerateToken(userID, sessionID primitive.ObjectID, version int64) (string, error) {
+	if keys == nil {
+		return "", errKeySetNotLoaded
+	}
+	now := time.Now()
+	claims := AccessClaims{
+		UserID:       userID.Hex(),
+		SessionID:    sessionID.Hex(),
+		TokenVersion: version,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    TokenIssuer(),
+			Subject:   userID.Hex(),
+			Audience:  jwt.ClaimStrings{TokenAudience()},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL())),
+		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecret)
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(keys.active.algorithm), claims)
+	token.Header["kid"] = keys.active.id
+	tokenString, err := token.SignedString(keys.active.signKey)
 	return tokenString, err
 }
 
-func ValidateToken(tokenString string) (*jwt.Token, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-	return token, err
+// ValidateToken memverifikasi tanda tangan token dengan kunci dari key set sesuai kid-nya,
+// lalu memeriksa iss, aud, exp, nbf dan iat. Semua klaim tersebut wajib ada.
+func ValidateToken(tokenString string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, verificationKey,
+		jwt.WithIssuer(TokenIssuer()),
+		jwt.WithAudience(TokenAudience()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(tokenLeeway),
+		jwt.WithValidMethods([]string{"HS256", "RS256", "ES256"}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	// jwt hanya memeriksa nbf dan iat jika ada, jadi keberadaannya diperiksa di sini
+	if claims.NotBefore == nil || claims.IssuedAt == nil || claims.UserID == "" || claims.SessionID == "" {
+		return nil, errMissingTokenClaims
+	}
+	return claims, nil
+}
+
+// GenerateRefreshToken membuat refresh token acak beserta hash yang disimpan di database
+func GenerateRefreshToken() (string, string, error) {
+	return generateOpaqueToken()
+}
+
+// GeneratePasswordResetToken membuat token reset password acak beserta hash yang disimpan
+// di database
+func GeneratePasswordResetToken() (string, string, error) {
+	return generateOpaqueToken()
+}
+
+// Fungsi helper untuk token acak 256-bit (base64 URL) dan hash SHA-256-nya
+func generateOpaqueToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashToken(token), nil
+}
+
+// HashToken mengembalikan hash SHA-256 (hex) dari token acak seperti refresh token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,283 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Fungsi helper untuk key set uji berisi secret HS256 aktif, kunci RSA dan kunci EC
+func setupTestKeySet(t *testing.T) (*rsa.PrivateKey, *ecdsa.PrivateKey) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := keys
+	t.Cleanup(func() { keys = previous })
+	secret := []byte("test-secret")
+	set := &keySet{byID: make(map[string]*signingKey)}
+	set.add(&signingKey{id: "hs", algorithm: "HS256", signKey: secret, verifyKey: secret})
+	set.add(&signingKey{id: "rsa", algorithm: "RS256", signKey: rsaKey, verifyKey: &rsaKey.PublicKey})
+	set.add(&signingKey{id: "ec", algorithm: "ES256", signKey: ecKey, verifyKey: &ecKey.PublicKey})
+	set.active = set.byID["hs"]
+	keys = set
+	return rsaKey, ecKey
+}
+
+func validClaims() AccessClaims {
+	now := time.Now()
+	userID := primitive.NewObjectID().Hex()
+	return AccessClaims{
+		UserID:    userID,
+		SessionID: primitive.NewObjectID().Hex(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    TokenIssuer(),
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{TokenAudience()},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+}
+
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims AccessClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	tokenString, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenString
+}
+
+func TestValidateToken(t *testing.T) {
+	rsaKey, ecKey := setupTestKeySet(t)
+	secret := []byte("test-secret")
+	rsaPublic, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modify := func(change func(*AccessClaims)) AccessClaims {
+		claims := validClaims()
+		change(&claims)
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token func() string
+		valid bool
+	}{
+		{"HS256", func() string { return signTestToken(t, jwt.SigningMethodHS256, "hs", secret, validClaims()) }, true},
+		{"RS256", func() string { return signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, validClaims()) }, true},
+		{"ES256", func() string { return signTestToken(t, jwt.SigningMethodES256, "ec", ecKey, validClaims()) }, true},
+		{"unknown kid", func() string { return signTestToken(t, jwt.SigningMethodHS256, "other", secret, validClaims()) }, false},
+		{"missing kid", func() string { return signTestToken(t, jwt.SigningMethodHS256, "", secret, validClaims()) }, false},
+		{"wrong alg for kid", func() string { return signTestToken(t, jwt.SigningMethodHS256, "rsa", secret, validClaims()) }, false},
+		{"HS256 signed with the RSA public key", func() string {
+			return signTestToken(t, jwt.SigningMethodHS256, "rsa", rsaPublic, validClaims())
+		}, false},
+		{"ES256 key used for RS256", func() string { return signTestToken(t, jwt.SigningMethodRS256, "ec", rsaKey, validClaims()) }, false},
+		{"alg none", func() string {
+			return signTestToken(t, jwt.SigningMethodNone, "hs", jwt.UnsafeAllowNoneSignatureType, validClaims())
+		}, false},
+		{"tampered signature", func() string {
+			return signTestToken(t, jwt.SigningMethodHS256, "hs", []byte("other-secret"), validClaims())
+		}, false},
+		{"missing nbf", func() string {
+			return signTestToken(t, jwt.SigningMethodHS256, "hs", secret, modify(func(c *AccessClaims) { c.NotBefore = nil }))
+		}, false},
+		{"missing iat", func() string {
+			return signTestToken(t, jwt.SigningMethodHS256, "hs", secret, modify(func(c *AccessClaims) { c.IssuedAt = nil }))
+		}, false},
+		{"missing exp", func() string {
+			return signTestToken(t, jwt.SigningMethodHS256, "hs", secret, modify(func(c *AccessClaims) { c.ExpiresAt = nil }))
+		}, false},
+		{"missing session", func() string {
+			return signTestToken(t, jwt.SigningMethodHS256, "hs", secret, modify(func(c *AccessClaims) { c.SessionID = "" }))
+		}, false},
+		{"wrong issuer", func() string {
+			return signTestToken(t, jwt.SigningMethodHS256, "hs", secret, modify(func(c *AccessClaims) { c.Issuer = "someone-else" }))
+		}, false},
+		{"missing issuer", func() string {
+			return signTestToken(t, jwt.SigningMethodHS256, "hs", secret, modify(func(c *AccessClaims) { c.Issuer = "" }))
+		}, false},
+		{"wrong audience", func() string {
+			return signTestToken(t, jwt.SigningMethodHS256, "hs", secret, modify(func(c *AccessClaims) { c.Audience = jwt.ClaimStrings{"other-api"} }))
+		}, false},
+		{"expired beyond leeway", func() string {
+			return signTestToken(t, jwt.SigningMethodHS256, "hs", secret, modify(func(c *AccessClaims) {
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-tokenLeeway - time.Second))
+			}))
+		}, false},
+		{"expired within leeway", func() string {
+			return signTestToken(t, jwt.SigningMethodHS256, "hs", secret, modify(func(c *AccessClaims) {
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-tokenLeeway / 2))
+			}))
+		}, true},
+		{"not yet valid", func() string {
+			return signTestToken(t, jwt.SigningMethodHS256, "hs", secret, modify(func(c *AccessClaims) {
+				c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+			}))
+		}, false},
+		{"issued in the future", func() string {
+			return signTestToken(t, jwt.SigningMethodHS256, "hs", secret, modify(func(c *AccessClaims) {
+				c.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+			}))
+		}, false},
+		{"malformed", func() string { return "not.a.token" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ValidateToken(tt.token())
+			if tt.valid {
+				if err != nil || claims == nil {
+					t.Fatalf("expected a valid token, got %v", err)
+				}
+				return
+			}
+			if err == nil || claims != nil {
+				t.Fatalf("expected the token to be rejected, got claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestValidateTokenWithoutKeySet(t *testing.T) {
+	setupTestKeySet(t)
+	token := signTestToken(t, jwt.SigningMethodHS256, "hs", []byte("test-secret"), validClaims())
+	keys = nil
+	if _, err := ValidateToken(token); err == nil {
+		t.Fatal("expected an error without a loaded key set")
+	}
+}
+
+func TestGenerateTokenRoundTrip(t *testing.T) {
+	setupTestKeySet(t)
+	userID, sessionID := primitive.NewObjectID(), primitive.NewObjectID()
+	token, err := GenerateToken(userID, sessionID, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != userID.Hex() || claims.SessionID != sessionID.Hex() || claims.TokenVersion != 3 {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+}
+
+// Fungsi helper untuk menulis kunci ke file PEM sementara
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadKeySet(t *testing.T) {
+	previous := keys
+	t.Cleanup(func() { keys = previous })
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPath := writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	oldPublic, _ := x509.MarshalPKIXPublicKey(&oldKey.PublicKey)
+	oldPath := writePEM(t, "PUBLIC KEY", oldPublic)
+	rsaPublic, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	rsaPublicPath := writePEM(t, "PUBLIC KEY", rsaPublic)
+	p384DER, _ := x509.MarshalECPrivateKey(p384Key)
+	p384Path := writePEM(t, "EC PRIVATE KEY", p384DER)
+
+	tests := []struct {
+		name       string
+		signingKey string
+		verifyKeys string
+		wantErr    bool
+		wantKids   []string
+	}{
+		{"HS256 secret", "", "", false, []string{"hs-default"}},
+		{"RSA with rotated EC key", rsaPath, "old=" + oldPath, false, []string{"default", "old"}},
+		{"public signing key", rsaPublicPath, "", true, nil},
+		{"unsupported curve", p384Path, "", true, nil},
+		{"duplicate kid", rsaPath, "default=" + oldPath, true, nil},
+		{"malformed verify entry", rsaPath, "old", true, nil},
+		{"missing file", filepath.Join(t.TempDir(), "missing.pem"), "", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_SIGNING_KEY", tt.signingKey)
+			t.Setenv("JWT_SIGNING_KID", "")
+			t.Setenv("JWT_VERIFY_KEYS", tt.verifyKeys)
+			keys = nil
+			err := LoadKeySet()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys.order) != len(tt.wantKids) {
+				t.Fatalf("expected kids %v, got %v", tt.wantKids, keys.order)
+			}
+			for i, kid := range tt.wantKids {
+				if keys.order[i] != kid {
+					t.Fatalf("expected kids %v, got %v", tt.wantKids, keys.order)
+				}
+			}
+
+			// Secret HS256 tidak boleh ikut diterbitkan di JWKS
+			published := JWKS()["keys"].([]map[string]string)
+			for _, key := range published {
+				if key["kid"] == "hs-default" {
+					t.Fatal("HS256 secret must not be published")
+				}
+			}
+
+			// Token dari kunci aktif harus lolos verifikasi, termasuk setelah rotasi
+			token, err := GenerateToken(primitive.NewObjectID(), primitive.NewObjectID(), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ValidateToken(token); err != nil {
+				t.Fatalf("token from the active key was rejected: %v", err)
+			}
+		})
+	}
+}